@@ -0,0 +1,77 @@
+package theme
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/digitallyserviced/tview"
+)
+
+// redrawDelay is how long BindApplication waits for more reloads or switches
+// before redrawing, so a burst of file events causes a single draw.
+var redrawDelay = 50 * time.Millisecond
+
+// BindApplication redraws app whenever a watched theme is reloaded, the
+// active theme in Themes changes or SetColorDepth or SetAnsiRemap changes how
+// it renders, re-applying the TagStyler and tview.Styles on the draw
+// goroutine first. Calling unbind stops the redraws.
+func BindApplication(app *tview.Application) (unbind func()) {
+	var (
+		mu      sync.Mutex
+		timer   *time.Timer
+		stopped atomic.Bool
+	)
+	redraw := func() {
+		if stopped.Load() {
+			return
+		}
+		app.QueueUpdateDraw(ApplyStyles)
+	}
+	schedule := func() {
+		if stopped.Load() {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if timer == nil {
+			timer = time.AfterFunc(redrawDelay, redraw)
+			return
+		}
+		timer.Reset(redrawDelay)
+	}
+
+	cancel := Subscribe(func(ev ReloadEvent) {
+		if ev.Err == nil {
+			schedule()
+		}
+	})
+	cancelSwitch := Themes.OnSwitch(func(string, *Theme) { schedule() })
+	cancelRender := onRenderChange(schedule)
+
+	return func() {
+		stopped.Store(true)
+		cancel()
+		cancelSwitch()
+		cancelRender()
+		mu.Lock()
+		if timer != nil {
+			timer.Stop()
+		}
+		mu.Unlock()
+	}
+}
+
+var renderHooks listeners[func()]
+
+// onRenderChange registers fn to be called when a setting that changes how
+// the current theme renders, rather than the theme itself, is changed.
+func onRenderChange(fn func()) (cancel func()) {
+	return renderHooks.add(fn)
+}
+
+func renderChanged() {
+	for _, fn := range renderHooks.get() {
+		fn()
+	}
+}
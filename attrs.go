@@ -0,0 +1,126 @@
+package theme
+
+import "strings"
+
+// Attribute specs are runs of attributeFlags letters, optionally switched
+// into a mode by a prefix: "+" adds the letters that follow (the default),
+// "-" removes them and "=" clears everything first, e.g. "+b-r" or "=bi".
+
+const attrModifiers = "+-="
+
+func hasAttrModifiers(spec string) bool {
+	return strings.ContainsAny(spec, attrModifiers)
+}
+
+// applyAttrs applies spec to the attribute set, a bit per attributeFlags
+// letter.
+func applyAttrs(set uint, spec string) uint {
+	mode := '+'
+	for _, r := range spec {
+		if strings.ContainsRune(attrModifiers, r) {
+			mode = r
+			if r == '=' {
+				set = 0
+			}
+			continue
+		}
+		i := strings.IndexRune(attributeFlags, r)
+		if i < 0 {
+			continue
+		}
+		if mode == '-' {
+			set &^= 1 << i
+		} else {
+			set |= 1 << i
+		}
+	}
+	return set
+}
+
+// attrString spells set in attributeFlags order.
+func attrString(set uint) string {
+	var sb strings.Builder
+	for i, r := range attributeFlags {
+		if set&(1<<i) != 0 {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// inheritAttributes returns a single spec with the effect of applying parent
+// and then spec, in its shortest spelling: "=" and the letters left, or the
+// letters added followed by "-" and those removed. Applying the result over
+// parent again changes nothing, so an already resolved style can be resolved
+// again.
+func inheritAttributes(parent, spec string) string {
+	var (
+		reset       bool
+		add, remove uint
+		mode        = '+'
+	)
+	for _, r := range parent + "+" + spec {
+		if strings.ContainsRune(attrModifiers, r) {
+			mode = r
+			if r == '=' {
+				reset, add, remove = true, 0, 0
+			}
+			continue
+		}
+		i := strings.IndexRune(attributeFlags, r)
+		if i < 0 {
+			continue
+		}
+		if mode == '-' {
+			add &^= 1 << i
+			if !reset {
+				remove |= 1 << i
+			}
+		} else {
+			add |= 1 << i
+			remove &^= 1 << i
+		}
+	}
+	switch {
+	case reset:
+		return "=" + attrString(add)
+	case remove != 0:
+		return attrString(add) + "-" + attrString(remove)
+	}
+	return attrString(add)
+}
+
+// resolveAttributes turns a single spec into plain attribute letters.
+func resolveAttributes(spec string) string {
+	return attrString(applyAttrs(0, spec))
+}
+
+// combineAttributes merges the attributes of a style tag with those of the
+// named styles it uses. The plain letters at the start of inline are the
+// starting set; each style's spec is applied to it in turn, then the
+// modifiers in inline, so the tag has the last word. An inline "-" resets
+// the attributes as in tview, leaving only those of the styles. The result
+// is "" when nothing set any attributes and "-" when they were all removed.
+func combineAttributes(inline string, styles ...string) string {
+	specified := inline != ""
+	if inline == "-" {
+		inline = ""
+	}
+	base, mods := inline, ""
+	if i := strings.IndexAny(inline, attrModifiers); i >= 0 {
+		base, mods = inline[:i], inline[i:]
+	}
+	set := applyAttrs(0, base)
+	for _, spec := range styles {
+		specified = specified || spec != ""
+		set = applyAttrs(set, spec)
+	}
+	set = applyAttrs(set, mods)
+	switch {
+	case !specified:
+		return ""
+	case set == 0:
+		return "-"
+	}
+	return attrString(set)
+}
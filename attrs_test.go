@@ -0,0 +1,154 @@
+package theme
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCombineAttributes(t *testing.T) {
+	tests := []struct {
+		name   string
+		inline string
+		styles []string
+		want   string
+	}{
+		{"nothing set", "", nil, ""},
+		{"empty style", "", []string{""}, ""},
+		{"inline only", "u", nil, "u"},
+		{"style only", "", []string{"r"}, "r"},
+		{"plain style adds", "u", []string{"b"}, "bu"},
+		{"plus style adds", "u", []string{"+b"}, "bu"},
+		{"minus style removes", "ru", []string{"-r"}, "u"},
+		{"equals style replaces", "ru", []string{"=bi"}, "bi"},
+		{"styles apply in order", "", []string{"r", "-r+b"}, "b"},
+		{"inline minus after style", "-r", []string{"rb"}, "b"},
+		{"inline plus after style", "+u", []string{"=b"}, "bu"},
+		{"inline equals after style", "=i", []string{"rb"}, "i"},
+		{"inline reset keeps styles", "-", []string{"b"}, "b"},
+		{"inline reset alone", "-", nil, "-"},
+		{"all removed", "r", []string{"-r"}, "-"},
+		{"base then modifiers", "u-b", []string{"b"}, "u"},
+		{"unknown letters ignored", "x", []string{"b"}, "b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := combineAttributes(tt.inline, tt.styles...); got != tt.want {
+				t.Errorf("combineAttributes(%q, %q) = %q, want %q", tt.inline, tt.styles, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInheritAttributes(t *testing.T) {
+	tests := []struct {
+		parent, spec, want string
+	}{
+		{"", "", ""},
+		{"r", "", "r"},
+		{"", "b", "b"},
+		{"r", "b", "br"},
+		{"r", "+b", "br"},
+		{"rb", "-r", "b-r"},
+		{"-r", "b", "b-r"},
+		{"-r", "r", "r"},
+		{"r", "=i", "=i"},
+		{"=i", "-i", "="},
+		{"=b", "u-b", "=u"},
+	}
+	for _, tt := range tests {
+		got := inheritAttributes(tt.parent, tt.spec)
+		if got != tt.want {
+			t.Errorf("inheritAttributes(%q, %q) = %q, want %q", tt.parent, tt.spec, got, tt.want)
+		}
+		if again := inheritAttributes(tt.parent, got); again != got {
+			t.Errorf("inheritAttributes(%q, %q) = %q, not stable when resolved again", tt.parent, got, again)
+		}
+		for _, set := range []string{"", "r", "bu"} {
+			want := attrString(applyAttrs(applyAttrs(applyAttrs(0, set), tt.parent), tt.spec))
+			if got := attrString(applyAttrs(applyAttrs(0, set), got)); got != want {
+				t.Errorf("inheritAttributes(%q, %q) over %q gives %q, want %q", tt.parent, tt.spec, set, got, want)
+			}
+		}
+	}
+}
+
+const attrsTheme = `
+[TagStyles.badgeText]
+  FG = "blue"
+  BG = "#313131"
+  Attributes = ""
+
+[TagStyles.bold]
+  FG = "red"
+  Attributes = "+b"
+
+[TagStyles.unreverse]
+  FG = "green"
+  Attributes = "-r"
+
+[TagStyles.only]
+  FG = "white"
+  Attributes = "=bi"
+
+[TagStyles.consoleMsg]
+  FG = "blue"
+  BG = "black"
+  Attributes = "r"
+
+[TagStyles.consoleMsgBold]
+  FG = "red"
+  Inherits = "consoleMsg"
+  Attributes = "+b"
+
+[TagStyles.panel]
+  FG = "yellow"
+  Attributes = "b"
+  AsBG = "#303030"
+
+[TagStyles.marked]
+  FG = "aqua"
+  BG = "navy"
+  Attributes = "u"
+  AsBGAttributes = "+i"
+`
+
+func TestTagStylerAttributes(t *testing.T) {
+	th, err := LoadThemeFrom(strings.NewReader(attrsTheme), FormatTOML, WithoutDefaults(), WithoutEnv())
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetColorDepth(TrueColor)
+	SetTheme(th)
+	styler := GetTagStyler(false)
+
+	tests := []struct {
+		name         string
+		fg, bg, attr string
+		want         [3]string
+	}{
+		{"plain colors untouched", "red", "blue", "b", [3]string{"red", "blue", "b"}},
+		{"empty style attributes", "badgeText", "", "", [3]string{"blue", "#313131", ""}},
+		{"inline kept with empty style", "badgeText", "", "u", [3]string{"blue", "#313131", "u"}},
+		{"plus style", "bold", "", "u", [3]string{"red", "", "bu"}},
+		{"minus style", "unreverse", "", "ru", [3]string{"green", "", "u"}},
+		{"minus style removes all", "unreverse", "", "r", [3]string{"green", "", "-"}},
+		{"equals style", "only", "", "ru", [3]string{"white", "", "bi"}},
+		{"inline minus over style", "bold", "", "-b", [3]string{"red", "", "-"}},
+		{"inline reset", "bold", "", "-", [3]string{"red", "", "b"}},
+		{"inherited attributes", "consoleMsgBold", "", "", [3]string{"red", "black", "br"}},
+		{"bg slot uses AsBG without attributes", "", "panel", "u", [3]string{"", "#303030", "u"}},
+		{"bg slot falls back to FG", "", "badgeText", "", [3]string{"", "blue", ""}},
+		{"bg slot opted-in attributes", "", "marked", "b", [3]string{"", "aqua", "bi"}},
+		{"bg slot .bg", "", "marked.bg", "", [3]string{"", "navy", "i"}},
+		{"fg and bg styles", "bold", "marked", "", [3]string{"red", "aqua", "bi"}},
+		{"fg .bg slot", "marked.bg", "", "", [3]string{"navy", "", ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fg, bg, attr := styler(tt.fg, tt.bg, tt.attr)
+			if got := [3]string{fg, bg, attr}; got != tt.want {
+				t.Errorf("styler(%q, %q, %q) = %q, want %q", tt.fg, tt.bg, tt.attr, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package theme
+
+import (
+	"sort"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+type ChangeKind int
+
+const (
+	Added ChangeKind = iota
+	Removed
+	Modified
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Modified:
+		return "modified"
+	}
+	return "unknown"
+}
+
+// Change is the before and after value of one key. Old is the zero value for
+// Added keys and New is the zero value for Removed ones.
+type Change[T comparable] struct {
+	Kind     ChangeKind
+	Old, New T
+}
+
+// ChangeSet describes how one theme differs from another, keyed by TagStyle
+// name, FormatString name and color role.
+type ChangeSet struct {
+	TagStyles     map[string]Change[TagStyle]
+	FormatStrings map[string]Change[string]
+	Colors        map[string]Change[tcell.Color]
+}
+
+// Diff returns the changes that turn old into new. A nil old is treated as an
+// empty theme.
+func Diff(old, new *Theme) ChangeSet {
+	if old == nil {
+		old = NewTheme()
+	}
+	oldColors := make(map[string]tcell.Color)
+	for role, c := range old.colorRoles() {
+		oldColors[role] = *c
+	}
+	newColors := make(map[string]tcell.Color)
+	for role, c := range new.colorRoles() {
+		newColors[role] = *c
+	}
+	return ChangeSet{
+		TagStyles:     diffMaps(old.TagStyles, new.TagStyles),
+		FormatStrings: diffMaps(old.FormatStrings, new.FormatStrings),
+		Colors:        diffMaps(oldColors, newColors),
+	}
+}
+
+func diffMaps[T comparable](old, new map[string]T) map[string]Change[T] {
+	changes := make(map[string]Change[T])
+	for key, o := range old {
+		n, ok := new[key]
+		switch {
+		case !ok:
+			changes[key] = Change[T]{Kind: Removed, Old: o}
+		case n != o:
+			changes[key] = Change[T]{Kind: Modified, Old: o, New: n}
+		}
+	}
+	for key, n := range new {
+		if _, ok := old[key]; !ok {
+			changes[key] = Change[T]{Kind: Added, New: n}
+		}
+	}
+	return changes
+}
+
+// Empty reports whether the two themes had the same styles, formats and colors.
+func (cs ChangeSet) Empty() bool {
+	return len(cs.TagStyles) == 0 && len(cs.FormatStrings) == 0 && len(cs.Colors) == 0
+}
+
+// StyleChanged reports whether any of the named TagStyles changed.
+func (cs ChangeSet) StyleChanged(names ...string) bool {
+	for _, name := range names {
+		if _, ok := cs.TagStyles[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ChangedStyles returns the sorted names of every added, removed or modified
+// TagStyle.
+func (cs ChangeSet) ChangedStyles() []string {
+	names := make([]string, 0, len(cs.TagStyles))
+	for name := range cs.TagStyles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
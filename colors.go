@@ -0,0 +1,139 @@
+package theme
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/knadh/koanf"
+	"github.com/mitchellh/mapstructure"
+)
+
+const colorsKey = "Colors"
+
+// colorRoles maps the [Colors] keys to the Theme fields they set.
+func (t *Theme) colorRoles() map[string]*tcell.Color {
+	return map[string]*tcell.Color{
+		"PrimitiveBackground": &t.PrimitiveBackground,
+		"HeaderBackground":    &t.HeaderBackground,
+		"GrayerBackground":    &t.GrayerBackground,
+		"SidebarBackground":   &t.SidebarBackground,
+		"SidebarLines":        &t.SidebarLines,
+		"ContentBackground":   &t.ContentBackground,
+		"Border":              &t.Border,
+		"Primary":             &t.Primary,
+		"Secondary":           &t.Secondary,
+		"TopbarBorder":        &t.TopbarBorder,
+		"InfoLabel":           &t.InfoLabel,
+	}
+}
+
+func colorRoleNames() []string {
+	roles := NewTheme().colorRoles()
+	names := make([]string, 0, len(roles))
+	for name := range roles {
+		names = append(names, name)
+	}
+	return names
+}
+
+// colorRole finds a color role by case-insensitive name.
+func (t *Theme) colorRole(name string) (*tcell.Color, bool) {
+	for role, c := range t.colorRoles() {
+		if strings.EqualFold(role, name) {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// colorString is the inverse of tcell.GetColor: named colors keep their
+// (shortest, then lexically first) name, RGB colors become #rrggbb.
+func colorString(c tcell.Color) string {
+	if c == tcell.ColorDefault || !c.Valid() {
+		return ""
+	}
+	if c&tcell.ColorIsRGB == 0 {
+		name := ""
+		for n, nc := range tcell.ColorNames {
+			if nc != c {
+				continue
+			}
+			if name == "" || len(n) < len(name) || (len(n) == len(name) && n < name) {
+				name = n
+			}
+		}
+		if name != "" {
+			return name
+		}
+	}
+	return fmt.Sprintf("#%06x", c.Hex())
+}
+
+var colorType = reflect.TypeOf(tcell.Color(0))
+
+// colorDecodeHook lets mapstructure decode color strings into tcell.Color
+// fields, rejecting anything tcell.GetColor would silently turn into the
+// default color.
+func colorDecodeHook(from, to reflect.Type, data interface{}) (interface{}, error) {
+	if to != colorType || from.Kind() != reflect.String {
+		return data, nil
+	}
+	s := data.(string)
+	if !validColor(s) {
+		return nil, fmt.Errorf("invalid color %q", s)
+	}
+	return parseColor(s), nil
+}
+
+// parseColor is tcell.GetColor plus the "-" and "default" spellings tview
+// accepts in style tags and case-insensitive names. s must already satisfy
+// validColor.
+func parseColor(s string) tcell.Color {
+	if s == "-" || s == "default" {
+		return tcell.ColorDefault
+	}
+	return tcell.GetColor(strings.ToLower(s))
+}
+
+// colorRolesSection holds just the color roles, so decoding [Colors] cannot
+// touch any other field of a Theme.
+type colorRolesSection struct {
+	PrimitiveBackground tcell.Color
+	HeaderBackground    tcell.Color
+	GrayerBackground    tcell.Color
+	SidebarBackground   tcell.Color
+	SidebarLines        tcell.Color
+	ContentBackground   tcell.Color
+	Border              tcell.Color
+	Primary             tcell.Color
+	Secondary           tcell.Color
+	TopbarBorder        tcell.Color
+	InfoLabel           tcell.Color
+}
+
+// unmarshalColors decodes the color strings under path into the color roles
+// of t. Roles missing from path keep their value.
+func unmarshalColors(ko *koanf.Koanf, path string, t *Theme) error {
+	var section colorRolesSection
+	v := reflect.ValueOf(&section).Elem()
+	roles := t.colorRoles()
+	for name, c := range roles {
+		v.FieldByName(name).Set(reflect.ValueOf(*c))
+	}
+	err := ko.UnmarshalWithConf(path, &section, koanf.UnmarshalConf{
+		DecoderConfig: &mapstructure.DecoderConfig{
+			DecodeHook:       colorDecodeHook,
+			Result:           &section,
+			WeaklyTypedInput: true,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	for name, c := range roles {
+		*c = v.FieldByName(name).Interface().(tcell.Color)
+	}
+	return nil
+}
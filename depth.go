@@ -0,0 +1,317 @@
+package theme
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/gdamore/tcell/v2/terminfo"
+)
+
+// ColorDepth is how many colors the terminal can show. Loaded themes keep a
+// copy of their styles and color roles reduced to each depth, and the
+// TagStyler serves the one for CurrentColorDepth.
+type ColorDepth int
+
+const (
+	TrueColor ColorDepth = iota
+	Color256
+	Color16
+	Monochrome
+)
+
+var colorDepthNames = map[ColorDepth]string{
+	TrueColor:  "truecolor",
+	Color256:   "256",
+	Color16:    "16",
+	Monochrome: "mono",
+}
+
+func (d ColorDepth) String() string {
+	if name, ok := colorDepthNames[d]; ok {
+		return name
+	}
+	return fmt.Sprintf("ColorDepth(%d)", int(d))
+}
+
+// ParseColorDepth accepts "truecolor" (or "24bit"), "256", "16" (or "8",
+// "ansi") and "mono" (or "none").
+func ParseColorDepth(s string) (ColorDepth, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "truecolor", "24bit", "true":
+		return TrueColor, nil
+	case "256":
+		return Color256, nil
+	case "16", "8", "ansi":
+		return Color16, nil
+	case "mono", "none", "0", "1":
+		return Monochrome, nil
+	}
+	return 0, fmt.Errorf("theme: unknown color depth %q", s)
+}
+
+// ColorDepthEnvVar is the environment variable that overrides color depth
+// detection, e.g. COOLOR_COLOR_DEPTH=256.
+func ColorDepthEnvVar() string {
+	return envName(AppName()) + "_COLOR_DEPTH"
+}
+
+// DetectColorDepth works out the terminal's color depth from, in order,
+// ColorDepthEnvVar, NO_COLOR, COLORTERM, TERM and its terminfo entry.
+func DetectColorDepth() ColorDepth {
+	if d, err := ParseColorDepth(os.Getenv(ColorDepthEnvVar())); err == nil {
+		return d
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		return Monochrome
+	}
+	switch strings.ToLower(os.Getenv("COLORTERM")) {
+	case "truecolor", "24bit":
+		return TrueColor
+	}
+	term := os.Getenv("TERM")
+	switch {
+	case term == "" || term == "dumb":
+		return Monochrome
+	case term == "linux":
+		return Color16
+	case strings.HasSuffix(term, "-direct") || strings.HasSuffix(term, "-truecolor"):
+		return TrueColor
+	case strings.Contains(term, "256color"):
+		return Color256
+	}
+	if ti, err := terminfo.LookupTerminfo(term); err == nil {
+		switch {
+		case ti.Colors >= 1<<24:
+			return TrueColor
+		case ti.Colors >= 256:
+			return Color256
+		case ti.Colors >= 8:
+			return Color16
+		}
+		return Monochrome
+	}
+	return Color256
+}
+
+var (
+	depthOnce sync.Once
+	depth     atomic.Int32
+)
+
+// CurrentColorDepth is the depth set with SetColorDepth, or detected with
+// DetectColorDepth on first use.
+func CurrentColorDepth() ColorDepth {
+	depthOnce.Do(func() {
+		depth.Store(int32(DetectColorDepth()))
+	})
+	return ColorDepth(depth.Load())
+}
+
+// SetColorDepth overrides the detected color depth. The TagStyler serves the
+// new depth straight away; tview.Styles follows on the next ApplyStyles, which
+// BindApplication runs before redrawing.
+func SetColorDepth(d ColorDepth) {
+	depthOnce.Do(func() {})
+	depth.Store(int32(d))
+	renderChanged()
+}
+
+// active is the current theme reduced to the current color depth.
+func active() *Theme {
+	return current().ForDepth(CurrentColorDepth())
+}
+
+// ForDepth returns t with every TagStyle, color role, palette entry and
+// tview color reduced to d. FormatStrings are left alone; tcell reduces the
+// colors written in them when drawing. Loaded themes are reduced once when
+// built; a theme built by hand from NewTheme is reduced on every call.
+func (t *Theme) ForDepth(d ColorDepth) *Theme {
+	if d == TrueColor {
+		return t
+	}
+	if v, ok := t.variants[d]; ok {
+		return v
+	}
+	return t.downsample(d)
+}
+
+// precomputeDepths fills in the variants served by ForDepth. It must run
+// before t is shared, as it does when a theme is loaded or shared.
+func (t *Theme) precomputeDepths() {
+	t.variants = make(map[ColorDepth]*Theme, len(colorDepthNames)-1)
+	for _, d := range []ColorDepth{Color256, Color16, Monochrome} {
+		t.variants[d] = t.downsample(d)
+	}
+}
+
+func (t *Theme) downsample(d ColorDepth) *Theme {
+	c := t.clone()
+	c.variants = nil
+	c.raw = nil
+	for _, styles := range []map[string]TagStyle{c.TagStyles, c.Ansi, c.AnsiOverride} {
+		for name, sty := range styles {
+			sty.FG = downsampleString(sty.FG, d)
+			sty.BG = downsampleString(sty.BG, d)
+			sty.AsBG = downsampleString(sty.AsBG, d)
+			styles[name] = sty
+		}
+	}
+	for name, col := range c.Palette {
+		c.Palette[name] = downsampleString(col, d)
+	}
+	for _, col := range c.colorRoles() {
+		*col = downsampleColor(*col, d)
+	}
+	v := reflect.ValueOf(&c.Tview).Elem()
+	for _, name := range tviewFields() {
+		f := v.FieldByName(name)
+		f.Set(reflect.ValueOf(downsampleColor(f.Interface().(tcell.Color), d)))
+	}
+	return c
+}
+
+// downsampleString reduces a style color, leaving the "no change" and
+// "default" spellings and anything that is not a color as they are.
+func downsampleString(s string, d ColorDepth) string {
+	switch s {
+	case "", "-", "default":
+		return s
+	}
+	if d == TrueColor || !validColor(s) {
+		return s
+	}
+	if d == Monochrome {
+		return "default"
+	}
+	return colorString(downsampleColor(parseColor(s), d))
+}
+
+func downsampleColor(c tcell.Color, d ColorDepth) tcell.Color {
+	if c == tcell.ColorDefault || !c.Valid() {
+		return c
+	}
+	switch d {
+	case TrueColor:
+		return c
+	case Monochrome:
+		return tcell.ColorDefault
+	}
+	if c&tcell.ColorIsRGB == 0 {
+		index := int(c &^ tcell.ColorValid)
+		if d == Color256 || index < 16 {
+			return c
+		}
+	}
+	return nearestPaletteColor(c, d)
+}
+
+var (
+	paletteLabOnce sync.Once
+	paletteLab     [256][3]float64
+)
+
+// nearestPaletteColor finds the palette entry closest to c: by CIE94 color
+// difference among 16-255 for Color256, since terminals commonly redefine the
+// first 16, or with nearestANSI among 0-15 for Color16.
+func nearestPaletteColor(c tcell.Color, d ColorDepth) tcell.Color {
+	paletteLabOnce.Do(func() {
+		for i := range paletteLab {
+			paletteLab[i] = lab(tcell.PaletteColor(i).RGB())
+		}
+	})
+	want := lab(c.RGB())
+	if d == Color16 {
+		return tcell.PaletteColor(nearestANSI(want))
+	}
+	best, bestDist := 16, math.Inf(1)
+	for i := 16; i < 256; i++ {
+		if dist := deltaE94(want, paletteLab[i]); dist < bestDist {
+			best, bestDist = i, dist
+		}
+	}
+	return tcell.PaletteColor(best)
+}
+
+var (
+	ansiGrays  = []int{0, 8, 7, 15}
+	ansiColors = []int{1, 2, 3, 4, 5, 6, 9, 10, 11, 12, 13, 14}
+)
+
+// nearGrayChroma is the CIELAB chroma below which a color reduces to one of
+// the four ANSI grays.
+const nearGrayChroma = 12
+
+// nearestANSI picks one of the 16 ANSI colors for want. The ANSI palette is
+// too sparse for a plain color difference, which sends most pastel and muted
+// colors to gray or silver, so near-gray colors go to the gray of closest
+// lightness and every other color keeps its hue: the closest hue wins, then
+// the closest lightness.
+func nearestANSI(want [3]float64) int {
+	gray := math.Hypot(want[1], want[2]) < nearGrayChroma
+	candidates := ansiColors
+	if gray {
+		candidates = ansiGrays
+	}
+	hue := math.Atan2(want[2], want[1])
+	best, bestDist := candidates[0], math.Inf(1)
+	for _, i := range candidates {
+		ref := paletteLab[i]
+		dL := want[0] - ref[0]
+		dist := dL * dL
+		if !gray {
+			dh := math.Abs(hue - math.Atan2(ref[2], ref[1]))
+			if dh > math.Pi {
+				dh = 2*math.Pi - dh
+			}
+			dh *= 180 / math.Pi
+			dist += dh * dh
+		}
+		if dist < bestDist {
+			best, bestDist = i, dist
+		}
+	}
+	return best
+}
+
+// lab converts an sRGB color to CIELAB with a D65 white point.
+func lab(r, g, b int32) [3]float64 {
+	linear := func(v int32) float64 {
+		c := float64(v) / 255
+		if c <= 0.04045 {
+			return c / 12.92
+		}
+		return math.Pow((c+0.055)/1.055, 2.4)
+	}
+	lr, lg, lb := linear(r), linear(g), linear(b)
+	x := (0.4124*lr + 0.3576*lg + 0.1805*lb) / 0.95047
+	y := 0.2126*lr + 0.7152*lg + 0.0722*lb
+	z := (0.0193*lr + 0.1192*lg + 0.9505*lb) / 1.08883
+	f := func(t float64) float64 {
+		if t > 216.0/24389 {
+			return math.Cbrt(t)
+		}
+		return (24389.0/27*t + 16) / 116
+	}
+	fx, fy, fz := f(x), f(y), f(z)
+	return [3]float64{116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)}
+}
+
+// deltaE94 is the squared CIE94 difference of sample from ref, with the
+// graphic arts weights.
+func deltaE94(ref, sample [3]float64) float64 {
+	dL := ref[0] - sample[0]
+	c1 := math.Hypot(ref[1], ref[2])
+	c2 := math.Hypot(sample[1], sample[2])
+	dC := c1 - c2
+	da, db := ref[1]-sample[1], ref[2]-sample[2]
+	dH2 := math.Max(0, da*da+db*db-dC*dC)
+	sC := 1 + 0.045*c1
+	sH := 1 + 0.015*c1
+	return dL*dL + (dC/sC)*(dC/sC) + dH2/(sH*sH)
+}
@@ -0,0 +1,47 @@
+package theme
+
+import "testing"
+
+// TestDownsample pins how the default theme's colors and some common accents
+// reduce to 256 and 16 colors. Accents must keep their hue at 16 colors.
+func TestDownsample(t *testing.T) {
+	tests := []struct {
+		color, want256, want16 string
+	}{
+		// [Palette] and [Colors]
+		{"#5c6370", "#626262", "gray"},
+		{"#343434", "#303030", "black"},
+		{"#303030", "#303030", "black"},
+		{"#1c1c1c", "#1c1c1c", "black"},
+		{"#282c34", "#303030", "black"},
+		{"#212121", "#262626", "black"},
+		{"#21252b", "#262626", "black"},
+		{"#4ed6aa", "#5fd7af", "aqua"},
+		{"#b5d1f6", "#afd7ff", "blue"},
+		// accents
+		{"orange", "#ffaf00", "yellow"},
+		{"pink", "#ffafaf", "red"},
+		{"#fda47f", "#ffaf87", "red"},
+		{"#e85c51", "#d75f5f", "red"},
+		{"#5a93aa", "#0087af", "teal"},
+		{"#7aa4a1", "#87afaf", "teal"},
+		{"#ad5c7c", "#af5f87", "fuchsia"},
+		{"#cb7985", "#d78787", "red"},
+		// [tview] and the 16 base names are kept
+		{"darkcyan", "#008787", "teal"},
+		{"gray", "gray", "gray"},
+		{"blue", "blue", "blue"},
+		{"white", "white", "white"},
+		// not colors
+		{"-", "-", "-"},
+		{"default", "default", "default"},
+	}
+	for _, tt := range tests {
+		if got := downsampleString(tt.color, Color256); got != tt.want256 {
+			t.Errorf("%s at 256 colors = %s, want %s", tt.color, got, tt.want256)
+		}
+		if got := downsampleString(tt.color, Color16); got != tt.want16 {
+			t.Errorf("%s at 16 colors = %s, want %s", tt.color, got, tt.want16)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package theme
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/gookit/goutil/fsutil"
+)
+
+const themeBaseName = "theme"
+
+var (
+	discoveryMu sync.RWMutex // guards appName, extraDirs and pickedPath
+	appName     = "coolor"
+	extraDirs   []string
+	pickedPath  string
+)
+
+// EmbeddedThemePath is what FindTheme and ThemePath report when no theme file
+// was found and the embedded default theme is used instead.
+const EmbeddedThemePath = "embedded:" + DefaultThemeName
+
+// FallbackThemePath is checked after every other search location. It can be
+// set at build time with -ldflags "-X ...FallbackThemePath=/usr/share/app/theme.toml".
+var FallbackThemePath string
+
+// SetAppName sets the directory name used under the XDG config dirs and the
+// prefix of the <APP>_THEME environment variable.
+func SetAppName(name string) {
+	discoveryMu.Lock()
+	defer discoveryMu.Unlock()
+	appName = name
+}
+
+func AppName() string {
+	discoveryMu.RLock()
+	defer discoveryMu.RUnlock()
+	return appName
+}
+
+// AddSearchDirs appends dirs to the locations searched after the XDG dirs.
+func AddSearchDirs(dirs ...string) {
+	discoveryMu.Lock()
+	defer discoveryMu.Unlock()
+	extraDirs = append(extraDirs, dirs...)
+}
+
+// ThemeEnvVar is the environment variable holding an explicit theme path,
+// e.g. COOLOR_THEME.
+func ThemeEnvVar() string {
+	return envName(AppName()) + "_THEME"
+}
+
+// SearchPaths lists the candidate theme files in the order they are tried,
+// not including the environment variable.
+func SearchPaths() []string {
+	discoveryMu.RLock()
+	app, dirs := appName, extraDirs
+	discoveryMu.RUnlock()
+	paths := make([]string, 0)
+
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		configHome = fsutil.Expand("~/.config")
+	}
+	paths = append(paths, themeFiles(filepath.Join(configHome, app))...)
+
+	configDirs := os.Getenv("XDG_CONFIG_DIRS")
+	if configDirs == "" {
+		configDirs = "/etc/xdg"
+	}
+	for _, dir := range filepath.SplitList(configDirs) {
+		if dir == "" {
+			continue
+		}
+		paths = append(paths, themeFiles(filepath.Join(dir, app))...)
+	}
+
+	for _, dir := range dirs {
+		paths = append(paths, themeFiles(fsutil.Expand(dir))...)
+	}
+
+	if FallbackThemePath != "" {
+		paths = append(paths, fsutil.Expand(FallbackThemePath))
+	}
+	return paths
+}
+
+// themeFiles lists theme.toml, theme.yaml, theme.yml and theme.json in dir.
+func themeFiles(dir string) []string {
+	files := make([]string, 0, len(themeExts))
+	for _, ext := range themeExts {
+		files = append(files, filepath.Join(dir, themeBaseName+ext))
+	}
+	return files
+}
+
+// FindTheme returns the theme file that would be loaded, or
+// EmbeddedThemePath if there is none. An explicit path in the environment
+// variable wins and must exist.
+func FindTheme() (string, error) {
+	if env := os.Getenv(ThemeEnvVar()); env != "" {
+		path := fsutil.Expand(env)
+		if !fsutil.IsFile(path) {
+			return "", fmt.Errorf("theme: %s=%s: file does not exist", ThemeEnvVar(), env)
+		}
+		return path, nil
+	}
+	for _, path := range SearchPaths() {
+		if fsutil.IsFile(path) {
+			return path, nil
+		}
+	}
+	return EmbeddedThemePath, nil
+}
+
+// ThemePath reports the file picked by the last DiscoverTheme or
+// WatchDiscoveredTheme call, EmbeddedThemePath if they fell back to the
+// embedded default, or "" if neither has been called.
+func ThemePath() string {
+	discoveryMu.RLock()
+	defer discoveryMu.RUnlock()
+	return pickedPath
+}
+
+func setPickedPath(path string) {
+	discoveryMu.Lock()
+	defer discoveryMu.Unlock()
+	pickedPath = path
+}
+
+// DiscoverTheme finds the theme file using FindTheme and loads it, returning
+// DefaultTheme if no file was found.
+func DiscoverTheme() (*Theme, error) {
+	path, err := FindTheme()
+	if err != nil {
+		return nil, err
+	}
+	var t *Theme
+	if path == EmbeddedThemePath {
+		t = DefaultTheme()
+	} else if t, err = LoadTheme(path); err != nil {
+		return nil, err
+	}
+	setPickedPath(path)
+	return t, nil
+}
+
+// WatchDiscoveredTheme is WatchTheme for the file found by FindTheme. If no
+// file was found it stops any watcher and makes DefaultTheme current.
+func WatchDiscoveredTheme() error {
+	path, err := FindTheme()
+	if err != nil {
+		return err
+	}
+	if path == EmbeddedThemePath {
+		if err := Unwatch(); err != nil {
+			return err
+		}
+		SetTheme(DefaultTheme())
+	} else if err := WatchTheme(path); err != nil {
+		return err
+	}
+	setPickedPath(path)
+	return nil
+}
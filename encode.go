@@ -0,0 +1,216 @@
+package theme
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+func tagStylesMap(styles map[string]TagStyle) map[string]interface{} {
+	m := make(map[string]interface{}, len(styles))
+	for name, sty := range styles {
+		fields := map[string]interface{}{
+			"FG":         sty.FG,
+			"BG":         sty.BG,
+			"Attributes": sty.Attributes,
+		}
+		for key, val := range map[string]string{
+			"Inherits":       sty.Inherits,
+			"AsBG":           sty.AsBG,
+			"AsBGAttributes": sty.AsBGAttributes,
+		} {
+			if val != "" {
+				fields[key] = val
+			}
+		}
+		m[name] = fields
+	}
+	return m
+}
+
+// ansiMap is tagStylesMap that writes entries with only a color as the bare
+// color, the way they are usually written.
+func ansiMap(styles map[string]TagStyle) map[string]interface{} {
+	m := tagStylesMap(styles)
+	for name, sty := range styles {
+		if sty == (TagStyle{FG: sty.FG}) {
+			m[name] = sty.FG
+		}
+	}
+	return m
+}
+
+// rawEntry is one entry of a loaded section as it was written, along with how
+// toMap wrote it once resolved.
+type rawEntry struct {
+	raw, loaded interface{}
+}
+
+// keepRaw remembers the entries of raw, the merged sections before palette
+// references, color expressions and Inherits were resolved. Marshal writes
+// them back in place of their resolved values for as long as they still
+// resolve to what t holds, so changed entries are written resolved.
+func (t *Theme) keepRaw(raw map[string]interface{}) {
+	t.raw = make(map[string]map[string]rawEntry)
+	for section, entries := range t.toMap() {
+		rawSection, _ := raw[section].(map[string]interface{})
+		kept := make(map[string]rawEntry)
+		for name, loaded := range entries.(map[string]interface{}) {
+			r, ok := rawSection[name]
+			if !ok {
+				continue
+			}
+			if fields, ok := r.(map[string]interface{}); ok && section == "Ansi" && len(fields) == 1 {
+				if fg, ok := fields["FG"].(string); ok {
+					r = fg
+				}
+			}
+			kept[name] = rawEntry{raw: r, loaded: loaded}
+		}
+		t.raw[section] = kept
+	}
+}
+
+// toMap returns the theme as the raw section layout read by the loader.
+// Entries unchanged since loading are written as they were in the file, with
+// their palette references, expressions and Inherits; anything else is
+// written resolved.
+func (t *Theme) toMap() map[string]interface{} {
+	colors := make(map[string]interface{})
+	for role, c := range t.colorRoles() {
+		colors[role] = colorString(*c)
+	}
+	formats := make(map[string]interface{}, len(t.FormatStrings))
+	for name, format := range t.FormatStrings {
+		formats[name] = format
+	}
+	palette := make(map[string]interface{}, len(t.Palette))
+	for name, c := range t.Palette {
+		palette[name] = c
+	}
+	m := map[string]interface{}{
+		paletteKey:      palette,
+		colorsKey:       colors,
+		"TagStyles":     tagStylesMap(t.TagStyles),
+		"FormatStrings": formats,
+		"Ansi":          ansiMap(t.Ansi),
+		tviewKey:        t.tviewMap(),
+	}
+	for section, entries := range t.raw {
+		resolved := m[section].(map[string]interface{})
+		for name, e := range entries {
+			if v, ok := resolved[name]; ok && reflect.DeepEqual(v, e.loaded) {
+				resolved[name] = e.raw
+			}
+		}
+	}
+	return m
+}
+
+// Marshal encodes the theme as format ("toml", "yaml" or "json"). Sections
+// and keys are written in sorted order so output is stable between calls.
+// Entries not changed since the theme was loaded keep their $name references,
+// color expressions and Inherits; the rest are written as resolved colors.
+func (t *Theme) Marshal(format string) ([]byte, error) {
+	pa, err := parserFor(format)
+	if err != nil {
+		return nil, err
+	}
+	var b []byte
+	switch normalizeFormat(format) {
+	case FormatYAML:
+		b, err = yaml.Marshal(yamlNode(t.toMap()))
+	default:
+		b, err = pa.Marshal(t.toMap())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("theme: encoding %s: %w", format, err)
+	}
+	return b, nil
+}
+
+// yamlNode builds the YAML document by hand so multi-line strings are double
+// quoted; yaml.v3 drops leading newlines from the block scalars it picks.
+func yamlNode(v interface{}) *yaml.Node {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		n := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for _, k := range keys {
+			n.Content = append(n.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: k},
+				yamlNode(v[k]),
+			)
+		}
+		return n
+	case string:
+		n := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v}
+		if strings.Contains(v, "\n") {
+			n.Style = yaml.DoubleQuotedStyle
+		}
+		return n
+	}
+	n := &yaml.Node{}
+	n.Encode(v)
+	return n
+}
+
+// WriteTo writes the theme to w as TOML. It implements io.WriterTo, whose
+// signature go vet enforces for any method named WriteTo, so the format is
+// chosen with WriteFormatTo instead of a second argument.
+func (t *Theme) WriteTo(w io.Writer) (int64, error) {
+	return t.WriteFormatTo(w, FormatTOML)
+}
+
+// WriteFormatTo writes the theme to w encoded as format ("toml", "yaml" or
+// "json").
+func (t *Theme) WriteFormatTo(w io.Writer, format string) (int64, error) {
+	b, err := t.Marshal(format)
+	if err != nil {
+		return 0, err
+	}
+	return io.Copy(w, bytes.NewReader(b))
+}
+
+// SaveFile writes the theme to path in the format implied by its extension.
+// The file is replaced by rename so watchers never see a partial write.
+func (t *Theme) SaveFile(path string) error {
+	b, err := t.Marshal(FormatOf(path))
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("theme: saving %s: %w", path, err)
+	}
+	tmp, err := os.CreateTemp(dir, ".theme-*")
+	if err != nil {
+		return fmt.Errorf("theme: saving %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("theme: saving %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("theme: saving %s: %w", path, err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return fmt.Errorf("theme: saving %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("theme: saving %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package theme
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const roundTripTheme = `
+[Palette]
+  accent = "#fda47f"
+  dim = "darken($accent, 20%)"
+
+[Colors]
+  Primary = "$accent"
+
+[TagStyles.note]
+  FG = "$dim"
+  Attributes = "+b-r"
+
+[TagStyles.noteBg]
+  Inherits = "note"
+  AsBG = "#303030"
+  AsBGAttributes = "u"
+
+[Ansi]
+  red = "#e85c51"
+
+[Ansi.blue]
+  FG = "#5a93aa"
+  Attributes = "b"
+
+[FormatStrings]
+  accented = "[$accent:-:b]%s[-:-:-]"
+`
+
+// exported returns the parts of t that are written by Marshal.
+func exported(t *Theme) Theme {
+	return Theme{
+		PrimitiveBackground: t.PrimitiveBackground,
+		HeaderBackground:    t.HeaderBackground,
+		GrayerBackground:    t.GrayerBackground,
+		SidebarBackground:   t.SidebarBackground,
+		SidebarLines:        t.SidebarLines,
+		ContentBackground:   t.ContentBackground,
+		Border:              t.Border,
+		Primary:             t.Primary,
+		Secondary:           t.Secondary,
+		TopbarBorder:        t.TopbarBorder,
+		InfoLabel:           t.InfoLabel,
+		Palette:             t.Palette,
+		TagStyles:           t.TagStyles,
+		Formats:             t.Formats,
+		FormatStrings:       t.FormatStrings,
+		Ansi:                t.Ansi,
+		AnsiOverride:        t.AnsiOverride,
+		Tview:               t.Tview,
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	custom, err := LoadThemeFrom(strings.NewReader(roundTripTheme), FormatTOML, WithoutEnv())
+	if err != nil {
+		t.Fatal(err)
+	}
+	themes := map[string]*Theme{
+		"default": DefaultTheme(),
+		"custom":  custom,
+	}
+	for name, want := range themes {
+		for _, format := range []string{FormatTOML, FormatYAML, FormatJSON} {
+			t.Run(name+"/"+format, func(t *testing.T) {
+				b, err := want.Marshal(format)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := LoadThemeFrom(bytes.NewReader(b), format, WithoutDefaults(), WithoutEnv())
+				if err != nil {
+					t.Fatalf("loading marshaled theme: %v\n%s", err, b)
+				}
+				if !reflect.DeepEqual(exported(got), exported(want)) {
+					t.Errorf("round trip changed the theme:\n got %+v\nwant %+v", exported(got), exported(want))
+				}
+				again, err := got.Marshal(format)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(again, b) {
+					t.Errorf("output not stable between calls:\n%s\n---\n%s", b, again)
+				}
+			})
+		}
+	}
+}
+
+func TestMarshalKeepsRaw(t *testing.T) {
+	th, err := LoadThemeFrom(strings.NewReader(roundTripTheme), FormatTOML, WithoutDefaults(), WithoutEnv())
+	if err != nil {
+		t.Fatal(err)
+	}
+	th.NewTagStyle("changed", "red", "", "b")
+	th.AddFormatString("accented", "[red]%s")
+	b, err := th.Marshal(FormatTOML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(b)
+	for _, want := range []string{
+		`dim = "darken($accent, 20%)"`,
+		`Primary = "$accent"`,
+		`FG = "$dim"`,
+		`Inherits = "note"`,
+		`accented = "[red]%s"`,
+		`red = "#e85c51"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %s:\n%s", want, out)
+		}
+	}
+	got, err := LoadThemeFrom(bytes.NewReader(b), FormatTOML, WithoutDefaults(), WithoutEnv())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.TagStyles["noteBg"].FG != th.TagStyles["note"].FG {
+		t.Error("noteBg no longer inherits from note")
+	}
+	if !reflect.DeepEqual(got.TagStyles["changed"], th.TagStyles["changed"]) {
+		t.Errorf("changed style written as %+v, want %+v", got.TagStyles["changed"], th.TagStyles["changed"])
+	}
+}
+
+func TestWriteTo(t *testing.T) {
+	want := DefaultTheme()
+	var buf bytes.Buffer
+	if _, err := want.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadThemeFrom(&buf, FormatTOML, WithoutDefaults(), WithoutEnv())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(exported(got), exported(want)) {
+		t.Error("WriteTo output does not load back to the same theme")
+	}
+}
@@ -0,0 +1,55 @@
+package theme
+
+import (
+	"strings"
+
+	"github.com/knadh/koanf"
+	"github.com/knadh/koanf/providers/env"
+)
+
+// envName upper-cases s and replaces anything outside [A-Z0-9] with '_'.
+func envName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, strings.ToUpper(s))
+}
+
+// EnvPrefix is the prefix of the variables in the environment override
+// layer, e.g. COOLOR_THEME_. The rest of the name is a key path with "__"
+// between parts; the section is matched case-insensitively and everything
+// after it is used as written:
+//
+//	COOLOR_THEME_TAGSTYLES__badgeText__BG=#000000
+//	COOLOR_THEME_COLORS__Primary=#4ed6aa
+//	COOLOR_THEME_PALETTE__surface=#262626
+func EnvPrefix() string {
+	return envName(AppName()) + "_THEME_"
+}
+
+func envKey(prefix string) func(string) string {
+	return func(key string) string {
+		parts := strings.Split(strings.TrimPrefix(key, prefix), "__")
+		if len(parts) < 2 {
+			return ""
+		}
+		for section := range knownSections {
+			if strings.EqualFold(section, parts[0]) {
+				parts[0] = section
+			}
+		}
+		return strings.Join(parts, ".")
+	}
+}
+
+// loadEnv merges the <APP>_THEME_* variables into l as the top layer.
+func loadEnv(l *themeLoader, opt koanf.Option) error {
+	prefix := EnvPrefix()
+	m, err := env.Provider(prefix, ".", envKey(prefix)).Read()
+	if err != nil || len(m) == 0 {
+		return err
+	}
+	return l.load("env "+prefix+"*", m, opt)
+}
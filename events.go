@@ -0,0 +1,112 @@
+package theme
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// ReloadEvent is sent to subscribers after a watched theme is reloaded. When
+// the reload failed Err is set, Theme is the theme still in use and Changes
+// is empty.
+type ReloadEvent struct {
+	Path    string
+	Theme   *Theme
+	Changes ChangeSet
+	Err     *ReloadError
+}
+
+// ReloadError is why a watched theme could not be reloaded. Diagnostics is
+// set when the file failed validation.
+type ReloadError struct {
+	Path        string
+	Err         error
+	Diagnostics []Diagnostic
+}
+
+func newReloadError(path string, err error) *ReloadError {
+	re := &ReloadError{Path: path, Err: err}
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		re.Diagnostics = verr.Diagnostics
+	}
+	return re
+}
+
+func (e *ReloadError) Error() string {
+	return fmt.Sprintf("theme: reloading %s: %v", e.Path, e.Err)
+}
+
+func (e *ReloadError) Unwrap() error {
+	return e.Err
+}
+
+var subscribers listeners[func(ReloadEvent)]
+
+// Subscribe registers fn to be called after every reload, after the new theme
+// has been made current. Subscribers run in registration order and a panic
+// in one does not stop the others. The returned cancel removes fn and may be
+// called more than once.
+func Subscribe(fn func(ReloadEvent)) (cancel func()) {
+	return subscribers.add(fn)
+}
+
+// SubscribeContext is Subscribe that also unsubscribes when ctx is done.
+func SubscribeContext(ctx context.Context, fn func(ReloadEvent)) (cancel func()) {
+	cancel = Subscribe(fn)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancel()
+		case <-done:
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			cancel()
+		})
+	}
+}
+
+var errorLog atomic.Pointer[log.Logger]
+
+func init() {
+	errorLog.Store(log.New(os.Stderr, "theme: ", log.LstdFlags))
+}
+
+// SetErrorLog sets where problems with no caller to return them to, such as a
+// panicking subscriber, are reported. They go to stderr by default, out of
+// the way of a tview screen drawn on stdout; nil discards them.
+func SetErrorLog(l *log.Logger) {
+	if l == nil {
+		l = log.New(io.Discard, "", 0)
+	}
+	errorLog.Store(l)
+}
+
+func logf(format string, args ...interface{}) {
+	errorLog.Load().Printf(format, args...)
+}
+
+func publish(ev ReloadEvent) {
+	for _, fn := range subscribers.get() {
+		notify(fn, ev)
+	}
+}
+
+func notify(fn func(ReloadEvent), ev ReloadEvent) {
+	defer func() {
+		if r := recover(); r != nil {
+			logf("reload subscriber panic: %v", r)
+		}
+	}()
+	fn(ev)
+}
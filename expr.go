@@ -0,0 +1,276 @@
+package theme
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// rxColorExpr matches the start of a color expression such as
+// lighten(#303030, 8%).
+var rxColorExpr = regexp.MustCompile(`^\s*[A-Za-z]+\s*\(`)
+
+func isColorExpr(s string) bool {
+	return rxColorExpr.MatchString(s)
+}
+
+// colorFuncs are the functions usable in color expressions. Amounts are
+// fractions, written either as 0.08 or 8%.
+//
+//	lighten(c, amount)  raise the HSL lightness of c by amount
+//	darken(c, amount)   lower the HSL lightness of c by amount
+//	mix(a, b[, weight]) blend weight of a (default 50%) with the rest of b
+//	alpha(c, opacity[, bg])
+//	                    c at opacity over bg, black if not given, since
+//	                    terminal colors have no alpha channel
+var colorFuncs = map[string]struct {
+	args []bool // true for a color argument, false for an amount
+	opt  int    // how many trailing arguments may be left out
+	fn   func(args []exprValue) tcell.Color
+}{
+	"lighten": {[]bool{true, false}, 0, func(a []exprValue) tcell.Color {
+		return shiftLightness(a[0].color, a[1].num)
+	}},
+	"darken": {[]bool{true, false}, 0, func(a []exprValue) tcell.Color {
+		return shiftLightness(a[0].color, -a[1].num)
+	}},
+	"mix": {[]bool{true, true, false}, 1, func(a []exprValue) tcell.Color {
+		w := 0.5
+		if len(a) > 2 {
+			w = a[2].num
+		}
+		return mixColors(a[0].color, a[1].color, w)
+	}},
+	"alpha": {[]bool{true, false, true}, 1, func(a []exprValue) tcell.Color {
+		bg := tcell.NewRGBColor(0, 0, 0)
+		if len(a) > 2 {
+			bg = a[2].color
+		}
+		return mixColors(a[0].color, bg, a[1].num)
+	}},
+}
+
+type exprValue struct {
+	color tcell.Color
+	num   float64
+	isNum bool
+}
+
+// evalColor evaluates a color expression to a #rrggbb string. lookup resolves
+// the $name palette references inside it.
+func evalColor(s string, lookup func(name string) (string, error)) (string, error) {
+	p := &exprParser{src: s, lookup: lookup}
+	v, err := p.value()
+	if err == nil {
+		p.space()
+		if p.pos < len(p.src) {
+			err = p.errorf("unexpected %q", p.src[p.pos:])
+		} else if v.isNum {
+			err = p.errorf("expected a color, got a number")
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("color expression %q: %w", s, err)
+	}
+	return fmt.Sprintf("#%06x", v.color.Hex()), nil
+}
+
+type exprParser struct {
+	src    string
+	pos    int
+	lookup func(name string) (string, error)
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("at offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *exprParser) space() {
+	for p.pos < len(p.src) && p.src[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// word reads the run of characters that may make up a name, number or hex
+// color.
+func (p *exprParser) word() string {
+	start := p.pos
+	for p.pos < len(p.src) && !strings.ContainsRune(" ,()", rune(p.src[p.pos])) {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *exprParser) value() (exprValue, error) {
+	p.space()
+	start := p.pos
+	w := p.word()
+	switch {
+	case w == "":
+		return exprValue{}, p.errorf("expected a color or amount")
+	case w[0] >= '0' && w[0] <= '9' || w[0] == '.':
+		return p.amount(start, w)
+	case w[0] == '$':
+		c, err := p.lookup(w[1:])
+		if err != nil {
+			return exprValue{}, err
+		}
+		return p.color(start, c)
+	}
+	p.space()
+	if p.pos < len(p.src) && p.src[p.pos] == '(' {
+		return p.call(start, strings.ToLower(w))
+	}
+	return p.color(start, w)
+}
+
+func (p *exprParser) amount(start int, w string) (exprValue, error) {
+	num, scale := w, 1.0
+	if strings.HasSuffix(w, "%") {
+		num, scale = w[:len(w)-1], 100
+	}
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil || n/scale < 0 || n/scale > 1 {
+		p.pos = start
+		return exprValue{}, p.errorf("invalid amount %q (want 0-1 or 0%%-100%%)", w)
+	}
+	return exprValue{num: n / scale, isNum: true}, nil
+}
+
+func (p *exprParser) color(start int, s string) (exprValue, error) {
+	if !validColor(s) || parseColor(s) == tcell.ColorDefault {
+		p.pos = start
+		return exprValue{}, p.errorf("invalid color %q", s)
+	}
+	return exprValue{color: parseColor(s)}, nil
+}
+
+func (p *exprParser) call(start int, name string) (exprValue, error) {
+	f, ok := colorFuncs[name]
+	if !ok {
+		p.pos = start
+		return exprValue{}, p.errorf("unknown function %q", name)
+	}
+	p.pos++ // (
+	var args []exprValue
+	for {
+		p.space()
+		if p.pos < len(p.src) && p.src[p.pos] == ')' && len(args) == 0 {
+			break
+		}
+		v, err := p.value()
+		if err != nil {
+			return exprValue{}, err
+		}
+		args = append(args, v)
+		p.space()
+		if p.pos < len(p.src) && p.src[p.pos] == ',' {
+			p.pos++
+			continue
+		}
+		break
+	}
+	if p.pos >= len(p.src) || p.src[p.pos] != ')' {
+		return exprValue{}, p.errorf("expected ')'")
+	}
+	p.pos++
+
+	if min := len(f.args) - f.opt; len(args) < min || len(args) > len(f.args) {
+		if f.opt == 0 {
+			return exprValue{}, fmt.Errorf("%s: takes %d arguments, got %d", name, min, len(args))
+		}
+		return exprValue{}, fmt.Errorf("%s: takes %d to %d arguments, got %d", name, min, len(f.args), len(args))
+	}
+	for i, a := range args {
+		if f.args[i] == a.isNum {
+			want := "a color"
+			if !f.args[i] {
+				want = "an amount"
+			}
+			return exprValue{}, fmt.Errorf("%s: argument %d must be %s", name, i+1, want)
+		}
+	}
+	return exprValue{color: f.fn(args)}, nil
+}
+
+func shiftLightness(c tcell.Color, by float64) tcell.Color {
+	h, s, l := rgbToHSL(c.RGB())
+	return hslToRGB(h, s, math.Max(0, math.Min(1, l+by)))
+}
+
+// mixColors blends w of a with 1-w of b.
+func mixColors(a, b tcell.Color, w float64) tcell.Color {
+	ar, ag, ab := a.RGB()
+	br, bg, bb := b.RGB()
+	blend := func(x, y int32) int32 {
+		return int32(math.Round(float64(x)*w + float64(y)*(1-w)))
+	}
+	return tcell.NewRGBColor(blend(ar, br), blend(ag, bg), blend(ab, bb))
+}
+
+func rgbToHSL(r, g, b int32) (h, s, l float64) {
+	rf, gf, bf := float64(r)/255, float64(g)/255, float64(b)/255
+	max := math.Max(rf, math.Max(gf, bf))
+	min := math.Min(rf, math.Min(gf, bf))
+	l = (max + min) / 2
+	if max == min {
+		return 0, 0, l
+	}
+	d := max - min
+	if l > 0.5 {
+		s = d / (2 - max - min)
+	} else {
+		s = d / (max + min)
+	}
+	switch max {
+	case rf:
+		h = (gf - bf) / d
+		if gf < bf {
+			h += 6
+		}
+	case gf:
+		h = (bf-rf)/d + 2
+	default:
+		h = (rf-gf)/d + 4
+	}
+	return h / 6, s, l
+}
+
+func hslToRGB(h, s, l float64) tcell.Color {
+	if s == 0 {
+		v := int32(math.Round(l * 255))
+		return tcell.NewRGBColor(v, v, v)
+	}
+	var q float64
+	if l < 0.5 {
+		q = l * (1 + s)
+	} else {
+		q = l + s - l*s
+	}
+	p := 2*l - q
+	hue := func(t float64) int32 {
+		if t < 0 {
+			t++
+		}
+		if t > 1 {
+			t--
+		}
+		var v float64
+		switch {
+		case t < 1.0/6:
+			v = p + (q-p)*6*t
+		case t < 1.0/2:
+			v = q
+		case t < 2.0/3:
+			v = p + (q-p)*(2.0/3-t)*6
+		default:
+			v = p
+		}
+		return int32(math.Round(v * 255))
+	}
+	return tcell.NewRGBColor(hue(h+1.0/3), hue(h), hue(h-1.0/3))
+}
@@ -0,0 +1,204 @@
+package theme
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gookit/goutil/fsutil"
+	"github.com/knadh/koanf"
+)
+
+const (
+	DefaultThemeName = "default"
+	extendsKey       = "extends"
+)
+
+// themeSource is somewhere raw theme data can be read from: a file on disk or
+// an in-memory document registered under a name.
+type themeSource struct {
+	name   string
+	path   string
+	data   []byte
+	format string
+}
+
+var (
+	sourcesMu    sync.RWMutex
+	themeSources = make(map[string]themeSource)
+)
+
+// RegisterThemeFile makes the file at path available to `extends = "name"`.
+func RegisterThemeFile(name, path string) {
+	registerSource(themeSource{name: name, path: path, format: FormatOf(path)})
+}
+
+// RegisterThemeData makes an in-memory theme document available to
+// `extends = "name"`.
+func RegisterThemeData(name string, data []byte, format string) {
+	registerSource(themeSource{name: name, data: data, format: format})
+}
+
+func registerSource(src themeSource) {
+	sourcesMu.Lock()
+	themeSources[src.name] = src
+	sourcesMu.Unlock()
+}
+
+func lookupSource(name string) (themeSource, bool) {
+	sourcesMu.RLock()
+	src, ok := themeSources[name]
+	sourcesMu.RUnlock()
+	if ok {
+		return src, true
+	}
+	if name == DefaultThemeName {
+		return themeSource{name: name, data: defaultThemeData, format: FormatTOML}, true
+	}
+	return themeSource{}, false
+}
+
+func (s themeSource) String() string {
+	if s.path != "" {
+		if abs, err := filepath.Abs(s.path); err == nil {
+			return abs
+		}
+		return s.path
+	}
+	return s.name
+}
+
+// themeLayer is one parsed source in an extends chain.
+type themeLayer struct {
+	src  themeSource
+	data []byte
+	m    map[string]interface{}
+}
+
+func (s themeSource) read() (themeLayer, error) {
+	l := themeLayer{src: s, data: s.data}
+	pa, err := parserFor(s.format)
+	if err != nil {
+		return l, err
+	}
+	if s.path != "" {
+		l.data, err = os.ReadFile(s.path)
+		if err != nil {
+			return l, err
+		}
+	}
+	l.m, err = pa.Unmarshal(l.data)
+	return l, err
+}
+
+// parent resolves the value of an extends key: a registered theme name, or a
+// path relative to the file that names it.
+func (s themeSource) parent(ref string) themeSource {
+	if src, ok := lookupSource(ref); ok {
+		return src
+	}
+	path := fsutil.Expand(ref)
+	if !filepath.IsAbs(path) && s.path != "" {
+		path = filepath.Join(filepath.Dir(s.path), path)
+	}
+	return themeSource{path: path, format: FormatOf(path)}
+}
+
+// followChain returns chain, the names followed so far through extends,
+// Inherits or palette references, with name added. If name is already in
+// chain the error spells out the cycle as kind, e.g. "inherits", with prefix
+// written before each name.
+func followChain(chain []string, name, kind, prefix string) ([]string, error) {
+	for i, seen := range chain {
+		if seen == name {
+			cycle := append(append([]string{}, chain[i:]...), name)
+			return nil, fmt.Errorf("%s cycle: %s%s", kind, prefix, strings.Join(cycle, " -> "+prefix))
+		}
+	}
+	return append(chain[:len(chain):len(chain)], name), nil
+}
+
+// resolveExtends returns the raw layers of src ordered from its root ancestor
+// down to src itself, with the extends key stripped from each.
+func resolveExtends(src themeSource, chain []string) ([]themeLayer, error) {
+	chain, err := followChain(chain, src.String(), extendsKey, "")
+	if err != nil {
+		return nil, fmt.Errorf("theme: %w", err)
+	}
+
+	l, err := src.read()
+	if err != nil {
+		return nil, fmt.Errorf("theme: loading %s: %w", src, err)
+	}
+	ext, ok := l.m[extendsKey]
+	if !ok {
+		return []themeLayer{l}, nil
+	}
+	delete(l.m, extendsKey)
+
+	ref, ok := ext.(string)
+	if !ok || ref == "" {
+		return nil, fmt.Errorf("theme: %s: %s must be a theme name or path", src, extendsKey)
+	}
+	layers, err := resolveExtends(src.parent(ref), chain)
+	if err != nil {
+		return nil, err
+	}
+	return append(layers, l), nil
+}
+
+// loadLayers merges src and everything it extends into l, ancestors first.
+func loadLayers(l *themeLoader, src themeSource, opt koanf.Option) error {
+	layers, err := resolveExtends(src, nil)
+	if err != nil {
+		return err
+	}
+	for _, layer := range layers {
+		if err := l.load(layer.src.String(), layer.m, opt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// canonicalizeKeys respells the case-insensitive keys of a raw layer (color
+// roles, tview fields, ANSI color names and TagStyle fields) the way the
+// embedded defaults do, so that "fg" in a YAML file overrides "FG" instead of
+// sitting beside it. An [Ansi] entry given as a bare color becomes its FG.
+func canonicalizeKeys(m map[string]interface{}) {
+	if colors, ok := m[colorsKey].(map[string]interface{}); ok {
+		renameKeys(colors, colorRoleNames())
+	}
+	if fields, ok := m[tviewKey].(map[string]interface{}); ok {
+		renameKeys(fields, tviewFields())
+	}
+	if ansi, ok := m["Ansi"].(map[string]interface{}); ok {
+		renameKeys(ansi, baseXtermAnsiColorNames)
+		for name, val := range ansi {
+			if c, ok := val.(string); ok {
+				ansi[name] = map[string]interface{}{"FG": c}
+			}
+		}
+	}
+	for _, section := range []string{"TagStyles", "Ansi"} {
+		styles, _ := m[section].(map[string]interface{})
+		for _, sty := range styles {
+			if fields, ok := sty.(map[string]interface{}); ok {
+				renameKeys(fields, tagStyleFields)
+			}
+		}
+	}
+}
+
+func renameKeys(m map[string]interface{}, canonical []string) {
+	for key, val := range m {
+		for _, c := range canonical {
+			if key != c && strings.EqualFold(key, c) {
+				delete(m, key)
+				m[c] = val
+			}
+		}
+	}
+}
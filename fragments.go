@@ -0,0 +1,81 @@
+package theme
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/knadh/koanf"
+)
+
+// FragmentDirName is the directory next to a theme file whose files are
+// merged over it, e.g. ~/.config/coolor/theme.d/ for plugins to ship their
+// own TagStyles and FormatStrings.
+const FragmentDirName = "theme.d"
+
+func isThemeFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, e := range themeExts {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// fragmentFiles lists the theme files in dir in lexical order. A missing
+// directory has no fragments.
+func fragmentFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("theme: reading %s: %w", dir, err)
+	}
+	files := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || !isThemeFile(e.Name()) {
+			continue
+		}
+		files = append(files, filepath.Join(dir, e.Name()))
+	}
+	return files, nil
+}
+
+func readFragments(dir string) ([]themeLayer, error) {
+	files, err := fragmentFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	layers := make([]themeLayer, 0, len(files))
+	for _, path := range files {
+		src := themeSource{path: path, format: FormatOf(path)}
+		l, err := src.read()
+		if err != nil {
+			return nil, fmt.Errorf("theme: loading %s: %w", src, err)
+		}
+		if _, ok := l.m[extendsKey]; ok {
+			return nil, fmt.Errorf("theme: %s: %s is not allowed in fragments", src, extendsKey)
+		}
+		layers = append(layers, l)
+	}
+	return layers, nil
+}
+
+// loadFragments merges every fragment in dir into l in lexical order.
+func loadFragments(l *themeLoader, dir string, opt koanf.Option) error {
+	layers, err := readFragments(dir)
+	if err != nil {
+		return err
+	}
+	for _, layer := range layers {
+		if err := l.load(layer.src.String(), layer.m, opt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package theme
+
+import (
+	"fmt"
+	"sort"
+)
+
+// resolveInherits fills the empty colors of every style that names another
+// with Inherits from that style and applies its attributes on top of that
+// style's, following chains of any length.
+func resolveInherits(styles map[string]TagStyle) error {
+	resolved := make(map[string]TagStyle, len(styles))
+	var resolve func(name string, chain []string) (TagStyle, error)
+	resolve = func(name string, chain []string) (TagStyle, error) {
+		if sty, ok := resolved[name]; ok {
+			return sty, nil
+		}
+		chain, err := followChain(chain, name, "inherits", "")
+		if err != nil {
+			return TagStyle{}, err
+		}
+		sty := styles[name]
+		if sty.Inherits != "" {
+			if _, ok := styles[sty.Inherits]; !ok {
+				return TagStyle{}, fmt.Errorf("%s: inherits unknown style %q", name, sty.Inherits)
+			}
+			parent, err := resolve(sty.Inherits, chain)
+			if err != nil {
+				return TagStyle{}, err
+			}
+			sty = sty.inherit(parent)
+		}
+		resolved[name] = sty
+		return sty, nil
+	}
+
+	names := make([]string, 0, len(styles))
+	for name := range styles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := resolve(name, nil); err != nil {
+			return err
+		}
+	}
+	for name, sty := range resolved {
+		styles[name] = sty
+	}
+	return nil
+}
+
+// inherit returns ts with its empty colors taken from parent and its
+// attribute specs applied on top of parent's.
+func (ts TagStyle) inherit(parent TagStyle) TagStyle {
+	if ts.FG == "" {
+		ts.FG = parent.FG
+	}
+	if ts.BG == "" {
+		ts.BG = parent.BG
+	}
+	ts.Attributes = inheritAttributes(parent.Attributes, ts.Attributes)
+	if ts.AsBG == "" {
+		ts.AsBG = parent.AsBG
+	}
+	ts.AsBGAttributes = inheritAttributes(parent.AsBGAttributes, ts.AsBGAttributes)
+	return ts
+}
@@ -0,0 +1,22 @@
+package theme
+
+import "testing"
+
+func TestCycleErrors(t *testing.T) {
+	err := resolveInherits(map[string]TagStyle{
+		"a": {Inherits: "b"},
+		"b": {Inherits: "c"},
+		"c": {Inherits: "a"},
+	})
+	if want := "inherits cycle: a -> b -> c -> a"; err == nil || err.Error() != want {
+		t.Errorf("resolveInherits error = %v, want %s", err, want)
+	}
+
+	_, err = resolvePalette(map[string]string{
+		"a": "$b",
+		"b": "lighten($a, 10%)",
+	})
+	if want := `Palette.a: color expression "lighten($a, 10%)": palette cycle: $a -> $b -> $a`; err == nil || err.Error() != want {
+		t.Errorf("resolvePalette error = %v, want %s", err, want)
+	}
+}
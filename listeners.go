@@ -0,0 +1,50 @@
+package theme
+
+import "sync"
+
+// listeners is a list of callbacks that may be added and removed while it is
+// being called.
+type listeners[F any] struct {
+	mu   sync.Mutex
+	list []*listener[F]
+}
+
+type listener[F any] struct {
+	fn F
+}
+
+// add appends fn. The returned cancel removes it and may be called more than
+// once.
+func (l *listeners[F]) add(fn F) (cancel func()) {
+	entry := &listener[F]{fn: fn}
+	l.mu.Lock()
+	l.list = append(l.list, entry)
+	l.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { l.remove(entry) })
+	}
+}
+
+func (l *listeners[F]) remove(entry *listener[F]) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, other := range l.list {
+		if other == entry {
+			l.list = append(l.list[:i:i], l.list[i+1:]...)
+			return
+		}
+	}
+}
+
+// get returns the callbacks in the order they were added.
+func (l *listeners[F]) get() []F {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fns := make([]F, len(l.list))
+	for i, entry := range l.list {
+		fns[i] = entry.fn
+	}
+	return fns
+}
@@ -0,0 +1,400 @@
+package theme
+
+import (
+	_ "embed"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/knadh/koanf"
+	"github.com/knadh/koanf/maps"
+	"github.com/knadh/koanf/parsers/json"
+	"github.com/knadh/koanf/parsers/toml"
+	"github.com/knadh/koanf/parsers/yaml"
+	"github.com/knadh/koanf/providers/confmap"
+)
+
+const (
+	FormatTOML = "toml"
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+)
+
+// themeExts are the file extensions recognised for theme files, in the
+// order they are tried during discovery.
+var themeExts = []string{".toml", ".yaml", ".yml", ".json"}
+
+//go:embed theme.toml
+var defaultThemeData []byte
+
+// NewTheme returns an empty theme. Its color roles are all tcell.ColorDefault
+// until a [Colors] section is loaded into it.
+func NewTheme() *Theme {
+	return &Theme{
+		state:         &themeState{},
+		Palette:       make(map[string]string),
+		TagStyles:     make(map[string]TagStyle),
+		Formats:       make(map[string]ThemeFormatter),
+		FormatStrings: make(map[string]string),
+		Ansi:          make(map[string]TagStyle),
+		AnsiOverride:  make(map[string]TagStyle),
+	}
+}
+
+// DefaultTheme returns the embedded theme.toml, used when nothing has been
+// loaded and as the base every loaded theme is layered on.
+func DefaultTheme() *Theme {
+	l, err := (&loadOptions{}).loader()
+	if err != nil {
+		panic(err)
+	}
+	t, err := l.theme()
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// DefaultThemeData returns the raw embedded default theme.
+func DefaultThemeData() []byte {
+	return append([]byte(nil), defaultThemeData...)
+}
+
+func loadDefaults(l *themeLoader) error {
+	m, err := toml.Parser().Unmarshal(defaultThemeData)
+	if err != nil {
+		return fmt.Errorf("theme: embedded default: %w", err)
+	}
+	return l.load(DefaultThemeName, m, withMerger())
+}
+
+func withMerger() koanf.Option {
+	return koanf.WithMergeFunc(func(src, dest map[string]interface{}) error {
+		_, err := merger(src, dest)
+		return err
+	})
+}
+
+func newKoanf() *koanf.Koanf {
+	return koanf.NewWithConf(koanf.Conf{
+		Delim:       ".",
+		StrictMerge: false,
+	})
+}
+
+// normalizeFormat maps a format name or extension to one of the Format
+// constants; unknown formats are returned lower-cased.
+func normalizeFormat(format string) string {
+	switch f := strings.ToLower(strings.TrimPrefix(format, ".")); f {
+	case "", FormatTOML:
+		return FormatTOML
+	case FormatYAML, "yml":
+		return FormatYAML
+	default:
+		return f
+	}
+}
+
+func parserFor(format string) (koanf.Parser, error) {
+	switch normalizeFormat(format) {
+	case FormatTOML:
+		return toml.Parser(), nil
+	case FormatYAML:
+		return yaml.Parser(), nil
+	case FormatJSON:
+		return json.Parser(), nil
+	}
+	return nil, fmt.Errorf("theme: unsupported format %q", format)
+}
+
+// FormatOf returns the theme format implied by the extension of path.
+func FormatOf(path string) string {
+	if f := normalizeFormat(filepath.Ext(path)); f == FormatYAML || f == FormatJSON {
+		return f
+	}
+	return FormatTOML
+}
+
+type loadOptions struct {
+	format       string
+	noDefaults   bool
+	noEnv        bool
+	fragmentDir  string
+	fragmentsSet bool
+}
+
+type LoadOption func(*loadOptions)
+
+// WithFormat forces the parser used for a theme file instead of picking it
+// from the file extension.
+func WithFormat(format string) LoadOption {
+	return func(o *loadOptions) {
+		o.format = format
+	}
+}
+
+// WithFragmentDir merges the theme files in dir over the main file instead
+// of those in the theme.d directory beside it.
+func WithFragmentDir(dir string) LoadOption {
+	return func(o *loadOptions) {
+		o.fragmentDir = dir
+		o.fragmentsSet = true
+	}
+}
+
+// WithoutFragments skips the theme.d directory.
+func WithoutFragments() LoadOption {
+	return func(o *loadOptions) {
+		o.fragmentDir = ""
+		o.fragmentsSet = true
+	}
+}
+
+// WithoutEnv ignores the <APP>_THEME_* environment override layer.
+func WithoutEnv() LoadOption {
+	return func(o *loadOptions) {
+		o.noEnv = true
+	}
+}
+
+// WithoutDefaults loads the file on its own instead of on top of the
+// embedded default theme.
+func WithoutDefaults() LoadOption {
+	return func(o *loadOptions) {
+		o.noDefaults = true
+	}
+}
+
+// newLoadOptions applies opts for loading the theme at path, which is "" when
+// reading from memory.
+func newLoadOptions(path, format string, opts []LoadOption) (*loadOptions, error) {
+	o := &loadOptions{format: format}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if !o.fragmentsSet && path != "" {
+		o.fragmentDir = filepath.Join(filepath.Dir(path), FragmentDirName)
+	}
+	if _, err := parserFor(o.format); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// themeLoader merges layers into a koanf instance, remembering which layer
+// last set each key.
+type themeLoader struct {
+	ko      *koanf.Koanf
+	layers  []string
+	origins map[string][]string
+}
+
+// load merges m over everything loaded so far as the layer called name.
+func (l *themeLoader) load(name string, m map[string]interface{}, opt koanf.Option) error {
+	canonicalizeKeys(m)
+	flat, _ := maps.Flatten(m, nil, l.ko.Delim())
+	if err := l.ko.Load(confmap.Provider(m, ""), nil, opt); err != nil {
+		return fmt.Errorf("theme: merging %s: %w", name, err)
+	}
+	for key := range flat {
+		l.origins[key] = append(l.origins[key], name)
+	}
+	l.layers = append(l.layers, name)
+	return nil
+}
+
+func (l *themeLoader) theme() (*Theme, error) {
+	t, err := themeFromKoanf(l.ko)
+	if err != nil {
+		return nil, err
+	}
+	t.layers = l.layers
+	t.origins = l.origins
+	t.precomputeDepths()
+	return t, nil
+}
+
+// Layers names the sources the theme was built from, lowest precedence first.
+func (t *Theme) Layers() []string {
+	return append([]string(nil), t.layers...)
+}
+
+// Origin names the layer that last set key, e.g. "TagStyles.badgeText.BG",
+// or "" if no layer did.
+func (t *Theme) Origin(key string) string {
+	if sources := t.origins[key]; len(sources) > 0 {
+		return sources[len(sources)-1]
+	}
+	return ""
+}
+
+// Sources names every layer that set key, lowest precedence first, so the
+// last entry is the one in effect and any before it were overridden.
+func (t *Theme) Sources(key string) []string {
+	return append([]string(nil), t.origins[key]...)
+}
+
+// loader returns a themeLoader holding whatever the loaded file is layered on.
+func (o *loadOptions) loader() (*themeLoader, error) {
+	l := &themeLoader{
+		ko:      newKoanf(),
+		origins: make(map[string][]string),
+	}
+	if o.noDefaults {
+		return l, nil
+	}
+	if err := loadDefaults(l); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// build loads src, what it extends, its fragments and then the environment
+// into l. This order is the precedence of the layers, lowest first.
+func (o *loadOptions) build(l *themeLoader, src themeSource) error {
+	if err := loadLayers(l, src, withMerger()); err != nil {
+		return err
+	}
+	if o.fragmentDir != "" {
+		if err := loadFragments(l, o.fragmentDir, withMerger()); err != nil {
+			return err
+		}
+	}
+	if o.noEnv {
+		return nil
+	}
+	return loadEnv(l, withMerger())
+}
+
+// load builds a theme from src with these options.
+func (o *loadOptions) load(src themeSource) (*Theme, error) {
+	l, err := o.loader()
+	if err != nil {
+		return nil, err
+	}
+	if err := o.build(l, src); err != nil {
+		return nil, err
+	}
+	t, err := l.theme()
+	if err != nil {
+		return nil, err
+	}
+	if src.path != "" {
+		t.source = src.String()
+	}
+	return t, nil
+}
+
+// LoadTheme reads the theme file at path. Layers are merged in this order,
+// each overriding the ones before it:
+//
+//  1. the embedded default theme (skipped by WithoutDefaults)
+//  2. the themes named by extends, root ancestor first
+//  3. the file at path
+//  4. the files in theme.d/ beside it, in lexical order (see WithFragmentDir)
+//  5. <APP>_THEME_* environment variables (skipped by WithoutEnv)
+//
+// Theme.Layers, Theme.Origin and Theme.Sources report what was applied. The format
+// is taken from the extension unless WithFormat is given. LoadTheme does not
+// make the theme current; pass the result to SetTheme for that.
+func LoadTheme(path string, opts ...LoadOption) (*Theme, error) {
+	o, err := newLoadOptions(path, FormatOf(path), opts)
+	if err != nil {
+		return nil, err
+	}
+	return o.load(themeSource{path: path, format: o.format})
+}
+
+// LoadThemeFrom reads a theme encoded in format ("toml", "yaml" or "json")
+// from r, layered the same way as LoadTheme. There are no fragments unless
+// WithFragmentDir is given.
+func LoadThemeFrom(r io.Reader, format string, opts ...LoadOption) (*Theme, error) {
+	o, err := newLoadOptions("", format, opts)
+	if err != nil {
+		return nil, err
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("theme: reading: %w", err)
+	}
+	return o.load(themeSource{name: "<reader>", data: b, format: o.format})
+}
+
+func themeFromKoanf(ko *koanf.Koanf) (*Theme, error) {
+	t := NewTheme()
+	raw := ko.Raw()
+	ko, palette, err := expandPalette(ko)
+	if err != nil {
+		return nil, err
+	}
+	t.Palette = palette
+	if err := ko.Unmarshal("TagStyles", &t.TagStyles); err != nil {
+		return nil, fmt.Errorf("theme: TagStyles: %w", err)
+	}
+	if err := ko.Unmarshal("FormatStrings", &t.FormatStrings); err != nil {
+		return nil, fmt.Errorf("theme: FormatStrings: %w", err)
+	}
+	if err := ko.Unmarshal("Ansi", &t.Ansi); err != nil {
+		return nil, fmt.Errorf("theme: Ansi: %w", err)
+	}
+	if err := resolveInherits(t.TagStyles); err != nil {
+		return nil, fmt.Errorf("theme: TagStyles: %w", err)
+	}
+	if err := resolveInherits(t.Ansi); err != nil {
+		return nil, fmt.Errorf("theme: Ansi: %w", err)
+	}
+	if err := unmarshalColors(ko, colorsKey, t); err != nil {
+		return nil, fmt.Errorf("theme: %s: %w", colorsKey, err)
+	}
+	refs := make(map[string]string)
+	if err := ko.Unmarshal(tviewKey, &refs); err != nil {
+		return nil, fmt.Errorf("theme: %s: %w", tviewKey, err)
+	}
+	if err := t.resolveTview(refs); err != nil {
+		return nil, fmt.Errorf("theme: %s: %w", tviewKey, err)
+	}
+	t.keepRaw(raw)
+	return t, nil
+}
+
+// reload validates and loads the theme at path for a watcher, both at the
+// start and after each change. A panic while decoding is turned into an error
+// so a bad edit never takes the app down.
+func (o *loadOptions) reload(path string, src themeSource, opts []LoadOption) (t *Theme, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			t, err = nil, fmt.Errorf("theme: %v", r)
+		}
+	}()
+	if err := ValidateFile(path, opts...); err != nil {
+		return nil, err
+	}
+	return o.load(src)
+}
+
+// SetTheme makes t the current theme and applies it to tview with
+// ApplyStyles, so like ApplyStyles it belongs on the draw goroutine or before
+// the application starts.
+func SetTheme(t *Theme) {
+	publishTheme(t)
+	ApplyStyles()
+}
+
+// publishTheme makes t the current theme without touching tview's globals,
+// for callers off the draw goroutine. The TagStyler picks it up on the next
+// draw; tview.Styles waits for the next ApplyStyles.
+func publishTheme(t *Theme) {
+	t.share()
+	theme.Store(t)
+}
+
+func current() *Theme {
+	if t := theme.Load(); t != nil {
+		return t
+	}
+	def := DefaultTheme()
+	def.share()
+	theme.CompareAndSwap(nil, def)
+	return theme.Load()
+}
@@ -0,0 +1,192 @@
+package theme
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/knadh/koanf"
+	"github.com/knadh/koanf/providers/confmap"
+)
+
+const paletteKey = "Palette"
+
+// rxPaletteRef matches a $name palette reference inside a style tag.
+var rxPaletteRef = regexp.MustCompile(`\$[A-Za-z_][A-Za-z0-9_-]*`)
+
+// rxStyleTag matches a tview style tag such as [$primary:$surface:b] or
+// [%[1]s:$surface], allowing the explicit argument indexes of fmt verbs.
+var rxStyleTag = regexp.MustCompile(`\[(?:[^\[\]]|%\[\d+\])*\]`)
+
+func isPaletteRef(s string) bool {
+	return strings.HasPrefix(s, "$")
+}
+
+// resolvePalette returns the palette with every entry that names another
+// entry, or is a color expression, replaced by its color.
+func resolvePalette(raw map[string]string) (map[string]string, error) {
+	resolved := make(map[string]string, len(raw))
+	var resolve func(name string, chain []string) (string, error)
+	resolve = func(name string, chain []string) (string, error) {
+		if c, ok := resolved[name]; ok {
+			return c, nil
+		}
+		chain, err := followChain(chain, name, "palette", "$")
+		if err != nil {
+			return "", err
+		}
+		c, ok := raw[name]
+		if !ok {
+			return "", fmt.Errorf("unknown palette color %q", "$"+name)
+		}
+		switch {
+		case isPaletteRef(c):
+			c, err = resolve(c[1:], chain)
+		case isColorExpr(c):
+			c, err = evalColor(c, func(ref string) (string, error) {
+				return resolve(ref, chain)
+			})
+		case validColor(c):
+			c = strings.ToLower(c)
+		}
+		if err != nil {
+			return "", err
+		}
+		resolved[name] = c
+		return c, nil
+	}
+	names := make([]string, 0, len(raw))
+	for name := range raw {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := resolve(name, nil); err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", paletteKey, name, err)
+		}
+	}
+	return resolved, nil
+}
+
+// palette substitutes $name references with colors from a resolved palette.
+type palette map[string]string
+
+func (p palette) lookup(name string) (string, error) {
+	c, ok := p[name]
+	if !ok {
+		return "", fmt.Errorf("unknown palette color %q", "$"+name)
+	}
+	return c, nil
+}
+
+// color resolves a palette reference or color expression and lowercases
+// color names, which tview looks up as written; anything else is returned
+// unchanged.
+func (p palette) color(path, s string) (string, error) {
+	var (
+		c   = s
+		err error
+	)
+	switch {
+	case isPaletteRef(s):
+		c, err = p.lookup(s[1:])
+	case isColorExpr(s):
+		c, err = evalColor(s, p.lookup)
+	case validColor(s):
+		c = strings.ToLower(s)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// tags replaces the references to known palette colors inside the style tags
+// of a FormatString. Anything else, such as template variables, is left as is.
+func (p palette) tags(s string) string {
+	return rxStyleTag.ReplaceAllStringFunc(s, func(tag string) string {
+		return rxPaletteRef.ReplaceAllStringFunc(tag, func(ref string) string {
+			if c, ok := p[ref[1:]]; ok {
+				return c
+			}
+			return ref
+		})
+	})
+}
+
+func (p palette) expandValues(section string, m map[string]interface{}) error {
+	for key, val := range m {
+		if str, ok := val.(string); ok {
+			c, err := p.color(section+"."+key, str)
+			if err != nil {
+				return err
+			}
+			m[key] = c
+		}
+	}
+	return nil
+}
+
+// expand replaces palette references and color expressions throughout the raw
+// theme m: color roles, tview fields, TagStyle and Ansi colors, and palette
+// references in the tags of FormatStrings.
+func (p palette) expand(m map[string]interface{}) error {
+	for _, section := range []string{colorsKey, tviewKey} {
+		if values, ok := m[section].(map[string]interface{}); ok {
+			if err := p.expandValues(section, values); err != nil {
+				return err
+			}
+		}
+	}
+	for _, section := range []string{"TagStyles", "Ansi"} {
+		styles, _ := m[section].(map[string]interface{})
+		for name, sty := range styles {
+			fields, ok := sty.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for _, field := range []string{"FG", "BG", "AsBG"} {
+				str, ok := fields[field].(string)
+				if !ok {
+					continue
+				}
+				c, err := p.color(section+"."+name+"."+field, str)
+				if err != nil {
+					return err
+				}
+				fields[field] = c
+			}
+		}
+	}
+	if formats, ok := m["FormatStrings"].(map[string]interface{}); ok {
+		for name, val := range formats {
+			if str, ok := val.(string); ok {
+				formats[name] = p.tags(str)
+			}
+		}
+	}
+	return nil
+}
+
+// expandPalette returns a copy of ko with every palette reference and color
+// expression replaced by its color, along with the resolved palette.
+func expandPalette(ko *koanf.Koanf) (*koanf.Koanf, map[string]string, error) {
+	raw := make(map[string]string)
+	if err := ko.Unmarshal(paletteKey, &raw); err != nil {
+		return nil, nil, fmt.Errorf("theme: %s: %w", paletteKey, err)
+	}
+	resolved, err := resolvePalette(raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("theme: %w", err)
+	}
+	m := ko.Raw()
+	if err := palette(resolved).expand(m); err != nil {
+		return nil, nil, fmt.Errorf("theme: %w", err)
+	}
+	out := newKoanf()
+	if err := out.Load(confmap.Provider(m, ""), nil); err != nil {
+		return nil, nil, fmt.Errorf("theme: %w", err)
+	}
+	return out, resolved, nil
+}
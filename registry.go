@@ -0,0 +1,168 @@
+package theme
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+type SwitchFunc func(name string, t *Theme)
+
+// Registry holds named themes, one of which is active.
+type Registry struct {
+	mu        sync.RWMutex
+	switchMu  sync.Mutex // serializes making a theme current
+	themes    map[string]*Theme
+	active    string
+	listeners listeners[SwitchFunc]
+}
+
+// Themes is the package registry used by the top-level helpers.
+var Themes = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{
+		themes: make(map[string]*Theme),
+	}
+}
+
+// Register adds t under name, replacing any theme already registered under
+// it. Replacing the active theme makes the new one active.
+func (r *Registry) Register(name string, t *Theme) {
+	t.share()
+	r.switchMu.Lock()
+	defer r.switchMu.Unlock()
+	r.mu.Lock()
+	r.themes[name] = t
+	isActive := r.active == name
+	r.mu.Unlock()
+
+	if isActive {
+		r.apply(name, t)
+	}
+}
+
+// LoadFile loads the theme at path with LoadTheme and registers it under name.
+// The file also becomes available to `extends = "name"`.
+func (r *Registry) LoadFile(name, path string, opts ...LoadOption) error {
+	t, err := LoadTheme(path, opts...)
+	if err != nil {
+		return err
+	}
+	RegisterThemeFile(name, path)
+	r.Register(name, t)
+	return nil
+}
+
+func (r *Registry) Get(name string) (*Theme, bool) {
+	r.mu.RLock()
+	t, ok := r.themes[name]
+	r.mu.RUnlock()
+	if !ok && name == DefaultThemeName {
+		t = DefaultTheme()
+		r.mu.Lock()
+		if existing, ok := r.themes[name]; ok {
+			t = existing
+		} else {
+			r.themes[name] = t
+		}
+		r.mu.Unlock()
+		return t, true
+	}
+	return t, ok
+}
+
+// Names returns the registered theme names in sorted order.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.themes))
+	for name := range r.themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Remove unregisters name. The active theme cannot be removed, including one
+// that a concurrent SetActive is about to make active.
+func (r *Registry) Remove(name string) error {
+	r.switchMu.Lock()
+	defer r.switchMu.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if name == r.active {
+		return fmt.Errorf("theme: cannot remove active theme %q", name)
+	}
+	delete(r.themes, name)
+	return nil
+}
+
+// Active returns the name and theme last passed to SetActive.
+func (r *Registry) Active() (string, *Theme) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.active, r.themes[r.active]
+}
+
+// SetActive makes the named theme current, re-applies tview.Styles and the
+// TagStyler, then calls every OnSwitch listener. Concurrent calls take effect
+// one at a time, so the active name always matches the current theme; a
+// listener must not call SetActive or Register itself. Like SetTheme, it
+// belongs on the draw goroutine or before the application starts.
+func (r *Registry) SetActive(name string) error {
+	r.switchMu.Lock()
+	defer r.switchMu.Unlock()
+	t, ok := r.Get(name)
+	if !ok {
+		return fmt.Errorf("theme: no theme registered as %q", name)
+	}
+	r.mu.Lock()
+	r.active = name
+	r.mu.Unlock()
+
+	r.apply(name, t)
+	return nil
+}
+
+// OnSwitch registers fn to be called after the active theme changes. The
+// returned cancel removes it and may be called more than once.
+func (r *Registry) OnSwitch(fn SwitchFunc) (cancel func()) {
+	return r.listeners.add(fn)
+}
+
+func (r *Registry) apply(name string, t *Theme) {
+	SetTheme(t)
+	for _, fn := range r.listeners.get() {
+		fn(name, t)
+	}
+}
+
+// replace puts c in place of old wherever it is registered.
+func (r *Registry) replace(old, c *Theme) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name, t := range r.themes {
+		if t == old {
+			r.themes[name] = c
+		}
+	}
+}
+
+// replaceSource re-registers t, reloaded from the file at path, under every
+// name whose theme was loaded from that file.
+func (r *Registry) replaceSource(path string, t *Theme) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t.share()
+	for name, old := range r.themes {
+		if old.source == path {
+			r.themes[name] = t
+		}
+	}
+}
+
+// SetActiveTheme switches the package registry to the named theme.
+func SetActiveTheme(name string) error {
+	return Themes.SetActive(name)
+}
@@ -0,0 +1,43 @@
+package theme
+
+import "testing"
+
+func TestMutateRegisteredTheme(t *testing.T) {
+	r := Themes
+	dark, light := DefaultTheme(), DefaultTheme()
+	r.Register("dark", dark)
+	r.Register("light", light)
+	defer r.Remove("light")
+	if err := r.SetActive("dark"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetActive("light"); err != nil {
+		t.Fatal(err)
+	}
+
+	changed := dark.NewTagStyle("darkOnly", "red")
+	if _, ok := dark.TagStyles["darkOnly"]; ok {
+		t.Error("registered theme was modified in place")
+	}
+	if _, ok := GetTagStyle("darkOnly"); ok {
+		t.Error("style landed in the current light theme")
+	}
+	if got, _ := r.Get("dark"); got != changed {
+		t.Error("registry entry not replaced by the changed theme")
+	}
+
+	if err := r.SetActive("dark"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := GetTagStyle("darkOnly"); !ok {
+		t.Error("style missing after switching back to dark")
+	}
+
+	again := dark.NewTagStyle("second", "blue")
+	if _, ok := again.TagStyles["darkOnly"]; !ok {
+		t.Error("changing a replaced theme lost the earlier change")
+	}
+	if current() != again {
+		t.Error("changed current theme was not made current")
+	}
+}
@@ -1,17 +1,17 @@
 package theme
 
 import (
-	"fmt"
 	"strings"
+	"sync/atomic"
 
 	"github.com/digitallyserviced/tview"
 	"github.com/gdamore/tcell/v2"
-	"github.com/gookit/goutil/fsutil"
-	"github.com/knadh/koanf"
-	"github.com/knadh/koanf/parsers/toml"
-	"github.com/knadh/koanf/providers/file"
 )
 
+// Theme is a snapshot of loaded styles. Once shared, by being made current or
+// registered in Themes, it is never modified in place: the mutating methods
+// make a changed copy that takes its place instead, so the draw goroutine can
+// read it while a reload is in progress.
 type Theme struct {
 	PrimitiveBackground tcell.Color
 	HeaderBackground    tcell.Color
@@ -24,11 +24,26 @@ type Theme struct {
 	Secondary           tcell.Color
 	TopbarBorder        tcell.Color
 	InfoLabel           tcell.Color
+	Palette             map[string]string
 	TagStyles           map[string]TagStyle
 	Formats             map[string]ThemeFormatter
 	FormatStrings       map[string]string
 	Ansi                map[string]TagStyle
 	AnsiOverride        map[string]TagStyle
+	Tview               tview.Theme
+
+	layers   []string
+	origins  map[string][]string
+	variants map[ColorDepth]*Theme
+	state    *themeState
+	source   string // absolute path of the file it was loaded from
+	raw      map[string]map[string]rawEntry
+}
+
+// themeState belongs to one Theme; copies get their own.
+type themeState struct {
+	shared atomic.Bool           // made current or registered, so read-only
+	next   atomic.Pointer[Theme] // the changed copy that took its place
 }
 
 const (
@@ -38,23 +53,18 @@ const (
 	twoColor    = "[{{.fg}}:{{.bg}}:b]{{.text}}[-:-:-]"
 )
 
+// TagStyle is a named style usable in place of a color in tview tags. Empty
+// colors are taken from the style named by Inherits, if any, and Attributes
+// apply on top of its attributes. Attributes are added to those of the tag;
+// "-r" removes reverse and "=bi" replaces them.
+//
+// Named in the background slot, as in [:name], a style gives its AsBG color
+// (FG if unset) and only applies AsBGAttributes.
 type TagStyle struct {
 	FG, BG, Attributes string
-}
-
-var tvtheme *tview.Theme = &tview.Theme{
-	PrimitiveBackgroundColor:    tcell.GetColor("#212121"),
-	ContrastBackgroundColor:     tcell.ColorBlue,
-	MoreContrastBackgroundColor: tcell.ColorGreen,
-	BorderColor:                 tcell.ColorWhite,
-	BorderFocusColor:            tcell.ColorBlue,
-	TitleColor:                  tcell.ColorWhite,
-	GraphicsColor:               tcell.ColorWhite,
-	PrimaryTextColor:            tcell.ColorWhite,
-	SecondaryTextColor:          tcell.ColorYellow,
-	TertiaryTextColor:           tcell.ColorGreen,
-	InverseTextColor:            tcell.ColorBlue,
-	ContrastSecondaryTextColor:  tcell.ColorDarkCyan,
+	Inherits           string
+	AsBG               string
+	AsBGAttributes     string
 }
 
 var baseXtermAnsiColorNames = []string{
@@ -76,9 +86,36 @@ var baseXtermAnsiColorNames = []string{
 	"white",
 }
 
-var theme *Theme
+var theme atomic.Pointer[Theme]
 
-var TagStyler tview.Styler = GetTagStyler(false)
+var (
+	ansiRemap   atomic.Bool
+	plainStyler = GetTagStyler(false)
+	ansiStyler  = GetTagStyler(true)
+)
+
+// TagStyler resolves TagStyle names in tview tags and, while ANSI remapping
+// is on, the 16 base color names through the theme's [Ansi] section.
+var TagStyler tview.Styler = func(fg, bg, attr string) (string, string, string) {
+	if ansiRemap.Load() {
+		return ansiStyler(fg, bg, attr)
+	}
+	return plainStyler(fg, bg, attr)
+}
+
+// SetAnsiRemap turns remapping of the base ANSI color names on or off, so
+// that a plain [red] in tview text follows the theme's red. It may be called
+// from any goroutine; the TagStyler checks it on every tag, and applications
+// bound with BindApplication are redrawn.
+func SetAnsiRemap(on bool) {
+	ansiRemap.Store(on)
+	renderChanged()
+}
+
+// AnsiRemap reports whether ANSI color names are being remapped.
+func AnsiRemap() bool {
+	return ansiRemap.Load()
+}
 
 func SetStyler() {
 	tview.UpdateCurrentStyler(TagStyler)
@@ -93,91 +130,6 @@ var (
 	bbg    SetBackgroundStyler[tview.Box] = tview.NewBox()
 )
 
-func defineStyles() {
-	bbg.SetBackgroundColor(tcell.Color100)
-
-	if theme != nil {
-		return
-	}
-	SetStyler()
-	tview.Styles = *tvtheme
-	theme = &Theme{
-		PrimitiveBackground: tcell.GetColor("#212121"),
-		HeaderBackground:    tcell.GetColor("#1C1C1C"),
-		GrayerBackground:    tcell.GetColor("#282c34"),
-		SidebarBackground:   tcell.GetColor("#21252B"),
-		SidebarLines:        tcell.GetColor("#5c6370"),
-		ContentBackground:   tcell.GetColor("#303030"),
-		Border:              tcell.GetColor("#1C1C1C"),
-		Primary:             tcell.GetColor("#4ed6aa"),
-		Secondary:           tcell.GetColor("#b5d1f6"),
-		TopbarBorder:        tcell.GetColor("#5c6370"),
-		InfoLabel:           tcell.GetColor("#5c6370"),
-		TagStyles:           make(map[string]TagStyle),
-		Formats:             make(map[string]ThemeFormatter),
-		FormatStrings:       make(map[string]string),
-		Ansi:                make(map[string]TagStyle),
-		AnsiOverride:        make(map[string]TagStyle),
-	}
-	ko := koanf.NewWithConf(koanf.Conf{
-		StrictMerge: false,
-	})
-	// f := file.Provider(fsutil.Expand("~/.config/coolor/theme.toml"))
-	f := file.Provider(fsutil.Expand("/work/coolors/theme.toml"))
-	f.Watch(func(event interface{}, err error) {
-		fmt.Println(event)
-		if err != nil {
-			fmt.Printf("watch error: %v", err)
-			return
-		}
-
-		fmt.Println("config changed. Reloading ...")
-		ko.Load(
-			f,
-			toml.Parser(),
-			koanf.WithMergeFunc(func(src, dest map[string]interface{}) error {
-				news, e := merger(src, dest)
-				if e != nil {
-					return e
-				}
-				fmt.Println("New keys", len(news), news)
-				return nil
-			}),
-		)
-		e := ko.Unmarshal("TagStyles", &theme.TagStyles)
-		if e != nil {
-			panic(e)
-		}
-		e = ko.Unmarshal("FormatStrings", &theme.FormatStrings)
-		if e != nil {
-			panic(e)
-		}
-		fmt.Println(theme.GetTheme().GetFormatString("seedText"))
-		if OnConfigReloaded != nil {
-			OnConfigReloaded(ko, &theme)
-		}
-	})
-	e := ko.Load(f, toml.Parser())
-	if e != nil {
-		panic(e)
-	}
-	e = ko.Unmarshal("TagStyles", &theme.TagStyles)
-	if e != nil {
-		panic(e)
-	}
-	e = ko.Unmarshal("FormatStrings", &theme.FormatStrings)
-	if e != nil {
-		panic(e)
-	}
-	fmt.Println(theme.GetTheme().GetFormatString("seedText"))
-
-	ResetAnsiOverrides()
-}
-
-type ConfigReloadFunc func(k *koanf.Koanf, i ...interface{})
-
-var OnConfigReloaded ConfigReloadFunc
-
 func init() {
 	merger = func(a, b map[string]interface{}) ([]string, error) {
 		news := make([]string, 0)
@@ -207,65 +159,121 @@ func init() {
 		}
 		return news, nil
 	}
-	defineStyles()
 }
 
+// clone returns a copy of t whose maps can be written without touching t.
+func (t *Theme) clone() *Theme {
+	c := *t
+	c.Palette = cloneMap(t.Palette)
+	c.TagStyles = cloneMap(t.TagStyles)
+	c.Formats = cloneMap(t.Formats)
+	c.FormatStrings = cloneMap(t.FormatStrings)
+	c.Ansi = cloneMap(t.Ansi)
+	c.AnsiOverride = cloneMap(t.AnsiOverride)
+	c.origins = cloneMap(t.origins)
+	c.layers = append([]string(nil), t.layers...)
+	c.variants = nil
+	c.state = &themeState{}
+	return &c
+}
+
+func cloneMap[K comparable, V any](m map[K]V) map[K]V {
+	c := make(map[K]V, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// share finishes t before another goroutine can see it. Until then t belongs
+// to its caller, so writing to it here is safe.
+func (t *Theme) share() {
+	if t.state == nil {
+		t.state = &themeState{}
+	}
+	if t.state.shared.Load() {
+		return
+	}
+	if t.variants == nil {
+		t.precomputeDepths()
+	}
+	t.state.shared.Store(true)
+}
+
+func (t *Theme) isShared() bool {
+	return t.state != nil && t.state.shared.Load()
+}
+
+// latest follows t to the copy that most recently took its place.
+func (t *Theme) latest() *Theme {
+	for t.state != nil {
+		next := t.state.next.Load()
+		if next == nil {
+			break
+		}
+		t = next
+	}
+	return t
+}
+
+// mutate applies fn to t in place if it has not been shared. Otherwise fn is
+// applied to a copy of the latest version of t, which then replaces it as the
+// current theme and in Themes wherever it was. The changed theme is returned.
+func (t *Theme) mutate(fn func(t *Theme)) *Theme {
+	if !t.isShared() {
+		fn(t)
+		if t.variants != nil {
+			t.precomputeDepths()
+		}
+		return t
+	}
+	for {
+		old := t.latest()
+		c := old.clone()
+		fn(c)
+		c.share()
+		if old.state.next.CompareAndSwap(nil, c) {
+			theme.CompareAndSwap(old, c)
+			Themes.replace(old, c)
+			return c
+		}
+	}
+}
+
+// update changes the current theme with fn.
+func update(fn func(t *Theme)) {
+	current().mutate(fn)
+}
+
+// NewTagStyle adds a style named name with FG, BG and Attributes taken from
+// args, returning the changed theme.
 func (t *Theme) NewTagStyle(
 	name string,
 	args ...string,
-) {
+) *Theme {
 	ts := NewStyle(args...)
-	t.TagStyles[name] = ts
+	return t.mutate(func(t *Theme) {
+		t.TagStyles[name] = ts
+	})
 }
 
+// WriteDefaultStyles copies the embedded default TagStyles into the current
+// theme, replacing any styles of the same name.
 func WriteDefaultStyles() {
-	theme.NewTagStyle("paletteTagsIcon", "yellow", "#5c6370")
-	theme.NewTagStyle("paletteTagsInfo", "black", "yellow")
-	theme.NewTagStyle("fieldLabel", "#303030", "blue")
-	theme.NewTagStyle("fieldInput", "blue", "#303030")
-	theme.NewTagStyle("badgeIcon", "yellow", "#303030")
-	theme.NewTagStyle("foreground", "white")
-	theme.NewTagStyle("cursor", "orange")
-	theme.NewTagStyle("background", "white", "#303030", "r")
-	theme.NewTagStyle("badgeText", "blue", "black")
-	theme.NewTagStyle("qcStatusInfo", "green", "black", "b")
-	theme.NewTagStyle("tblSortAsc", "blue", "black", "rb")
-	theme.NewTagStyle("tblSortDesc", "yellow", "black", "rb")
-
-	theme.NewTagStyle("shortcut", "", "#343434")
-	theme.NewTagStyle("shortcutIcon", "teal", "#343434")
-	theme.NewTagStyle("shortcutModifier", "#343434", "teal")
-	theme.NewTagStyle("shortcutLink", "teal", "red")
-	theme.NewTagStyle("shortcutKeys", "", "#343434")
-	theme.NewTagStyle("shortcutKey", "red", "#343434")
-	theme.NewTagStyle("shortcutAction", "yellow", "#343434")
-
-	theme.NewTagStyle("titleText", "red", "#343434")
-	theme.NewTagStyle("titleIcon", "#343434", "red")
-
-	theme.NewTagStyle("consoleIcon", "blue", "#303030")
-	theme.NewTagStyle("consoleMsg", "blue", "black", "r")
-	theme.NewTagStyle("consoleMsgPlugin", "green", "black", "r")
-	theme.NewTagStyle("consoleMsgErr", "red", "black", "r")
-	theme.NewTagStyle("consoleMsgPluginErr", "red", "black", "r")
-	theme.NewTagStyle("consoleMsgWarn", "yellow", "black", "r")
-	theme.NewTagStyle("consoleMsgDebug", "pink", "black", "r")
-	theme.NewTagStyle("scriptConsoleMsg", "green", "black", "r")
-	theme.NewTagStyle("scriptConsoleErr", "red", "black", "r")
-	theme.NewTagStyle("palette_name", "white", "red", "b")
-	theme.NewTagStyle("action", "red", "yellow")
-	theme.NewTagStyle("list_main", "green")
-	theme.NewTagStyle("list_second", "blue")
-	theme.NewTagStyle("input_placeholder", "yellow", "#2c3139")
-	theme.NewTagStyle("input_field", "blue", "#373e48")
-	theme.NewTagStyle("input_autocomplete", "red", "#373e48")
-	for _, v := range baseXtermAnsiColorNames {
-		theme.NewTagStyle(fmt.Sprintf("baseColorTag%s", v), v, "", "r")
-	}
+	defaults := DefaultTheme().TagStyles
+	update(func(t *Theme) {
+		for name, sty := range defaults {
+			t.TagStyles[name] = sty
+		}
+	})
 }
 
-func (t *Theme) AddFormatString(name, format string) {
-	t.FormatStrings[name] = format
+// AddFormatString sets the FormatString called name, returning the changed
+// theme.
+func (t *Theme) AddFormatString(name, format string) *Theme {
+	return t.mutate(func(t *Theme) {
+		t.FormatStrings[name] = format
+	})
 }
 
 func (t *Theme) GetFormatString(name string) string {
@@ -279,13 +287,13 @@ func (t *Theme) Get(name string) *tcell.Style {
 	if sty, ok := t.TagStyles[name]; ok {
 		style := tcell.StyleDefault
 		if sty.FG != "" {
-			style = style.Foreground(tcell.GetColor(sty.FG))
+			style = style.Foreground(parseColor(sty.FG))
 		}
 		if sty.BG != "" {
-			style = style.Background(tcell.GetColor(sty.BG))
+			style = style.Background(parseColor(sty.BG))
 		}
 		if sty.Attributes != "" {
-			for _, flag := range sty.Attributes {
+			for _, flag := range resolveAttributes(sty.Attributes) {
 				switch flag {
 				case 'l':
 					style = style.Blink(true)
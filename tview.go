@@ -0,0 +1,96 @@
+package theme
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/digitallyserviced/tview"
+	"github.com/gdamore/tcell/v2"
+)
+
+// tviewKey is the section holding values for the tview.Theme fields that
+// ApplyStyles copies into tview.Styles.
+const tviewKey = "tview"
+
+// ApplyStyles sets the TagStyler and copies the [tview] colors of the current
+// theme, at the current color depth, into tview.Styles. tview reads both
+// without locking, so call it on the draw goroutine, e.g. inside
+// Application.QueueUpdateDraw, or before the application starts.
+// BindApplication does this after every reload and switch.
+func ApplyStyles() {
+	SetStyler()
+	tview.Styles = active().Tview
+}
+
+// tviewFields lists the tcell.Color fields of tview.Theme.
+func tviewFields() []string {
+	typ := reflect.TypeOf(tview.Theme{})
+	names := make([]string, 0, typ.NumField())
+	for i := 0; i < typ.NumField(); i++ {
+		if typ.Field(i).Type == colorType {
+			names = append(names, typ.Field(i).Name)
+		}
+	}
+	return names
+}
+
+// lookupColor resolves a [tview] value: a color, a color role such as
+// "Primary", or a TagStyle name whose FG is used, with ".fg" or ".bg" to pick
+// the slot explicitly.
+func (t *Theme) lookupColor(ref string) (tcell.Color, error) {
+	if validColor(ref) {
+		return parseColor(ref), nil
+	}
+	name, slot := ref, ""
+	if i := strings.LastIndexByte(ref, '.'); i > 0 {
+		name, slot = ref[:i], strings.ToLower(ref[i+1:])
+	}
+	if slot == "" {
+		if c, ok := t.colorRole(name); ok {
+			return *c, nil
+		}
+	}
+	if sty, ok := t.TagStyles[name]; ok {
+		val := sty.FG
+		switch slot {
+		case "", "fg":
+		case "bg":
+			val = sty.BG
+		default:
+			return 0, fmt.Errorf("%q: unknown slot %q, want fg or bg", ref, slot)
+		}
+		if !validColor(val) {
+			return 0, fmt.Errorf("%q: TagStyle has invalid color %q", ref, val)
+		}
+		return parseColor(val), nil
+	}
+	return 0, fmt.Errorf("%q is not a color, color role or TagStyle", ref)
+}
+
+// resolveTview fills t.Tview from the raw [tview] values. It must run after
+// TagStyles and the color roles are loaded.
+func (t *Theme) resolveTview(refs map[string]string) error {
+	v := reflect.ValueOf(&t.Tview).Elem()
+	for name, ref := range refs {
+		f := v.FieldByName(name)
+		if !f.IsValid() || f.Type() != colorType {
+			return fmt.Errorf("unknown tview.Theme field %q", name)
+		}
+		c, err := t.lookupColor(ref)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		f.Set(reflect.ValueOf(c))
+	}
+	return nil
+}
+
+func (t *Theme) tviewMap() map[string]interface{} {
+	m := make(map[string]interface{})
+	v := reflect.ValueOf(t.Tview)
+	for _, name := range tviewFields() {
+		m[name] = colorString(v.FieldByName(name).Interface().(tcell.Color))
+	}
+	return m
+}
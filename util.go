@@ -11,7 +11,9 @@ import (
 )
 
 func ResetAnsiOverrides() {
-	theme.AnsiOverride = make(map[string]TagStyle)
+	update(func(t *Theme) {
+		t.AnsiOverride = make(map[string]TagStyle)
+	})
 }
 func NewStyle(
 	args ...string,
@@ -60,40 +62,88 @@ func Jcenter(s string, n int) string {
 
 
 func GetTagStyle(fg string, ansi ...bool) (TagStyle, bool) {
+	t := active()
 	if len(ansi) > 0 && ansi[0] {
-		if sty, ok := theme.AnsiOverride[fg]; ok {
+		name := strings.ToLower(fg)
+		if sty, ok := t.AnsiOverride[name]; ok {
+			return sty, true
+		}
+		if sty, ok := t.Ansi[name]; ok {
 			return sty, true
 		}
 	}
-	if sty, ok := theme.TagStyles[fg]; ok {
+	if sty, ok := t.TagStyles[fg]; ok {
 		return sty, true
 	}
 	return TagStyle{}, false
 }
 
+// slotStyle looks up a "name.fg" or "name.bg" reference to one color of a
+// TagStyle.
+func slotStyle(ref string, ansi bool) (color string, sty TagStyle, ok bool) {
+	i := strings.LastIndexByte(ref, '.')
+	if i <= 0 {
+		return "", sty, false
+	}
+	if sty, ok = GetTagStyle(ref[:i], ansi); !ok {
+		return "", sty, false
+	}
+	switch strings.ToLower(ref[i+1:]) {
+	case "fg":
+		return sty.FG, sty, true
+	case "bg":
+		return sty.BG, sty, true
+	}
+	return "", sty, false
+}
+
+// GetBackgroundStyle resolves a tag name used in the background slot, as in
+// [:badgeText]. The color is the style's AsBG, falling back to its FG, or the
+// slot picked with "name.fg" / "name.bg". attrs is the style's AsBGAttributes,
+// which is empty unless the style opts in.
+func GetBackgroundStyle(name string, ansi ...bool) (color, attrs string, ok bool) {
+	useAnsi := len(ansi) > 0 && ansi[0]
+	if c, sty, ok := slotStyle(name, useAnsi); ok {
+		return c, sty.AsBGAttributes, true
+	}
+	sty, ok := GetTagStyle(name, useAnsi)
+	if !ok {
+		return "", "", false
+	}
+	color = sty.AsBG
+	if color == "" {
+		color = sty.FG
+	}
+	return color, sty.AsBGAttributes, true
+}
+
 func GetTagStyler(ansi bool) tview.Styler {
 	return func(fg, bg, attr string) (newFgColor string, newBgColor string, newAttributes string) {
 		newFgColor = fg
 		newBgColor = bg
 		newAttributes = attr
-		if sty, ok := GetTagStyle(fg, ansi); ok {
+		styleAttrs := make([]string, 0, 2)
+		if c, _, ok := slotStyle(fg, ansi); ok {
+			if c != "" {
+				newFgColor = c
+			}
+		} else if sty, ok := GetTagStyle(fg, ansi); ok {
 			if sty.FG != "" {
 				newFgColor = sty.FG
 			}
 			if sty.BG != "" {
 				newBgColor = sty.BG
 			}
-			if sty.Attributes != "" {
-				newAttributes = sty.Attributes
-			}
+			styleAttrs = append(styleAttrs, sty.Attributes)
 		}
-		if sty, ok := GetTagStyle(bg, ansi); ok {
-			if sty.FG != "" {
-				newBgColor = sty.FG
-			}
-			if sty.Attributes != "" {
-				newAttributes = sty.Attributes
+		if c, attrs, ok := GetBackgroundStyle(bg, ansi); ok {
+			if c != "" {
+				newBgColor = c
 			}
+			styleAttrs = append(styleAttrs, attrs)
+		}
+		if len(styleAttrs) > 0 || hasAttrModifiers(attr) {
+			newAttributes = combineAttributes(attr, styleAttrs...)
 		}
 		return
 	}
@@ -126,9 +176,15 @@ func GetTagStyleArgsFromStyle(sty tcell.Style) (fg, bg, attrs string) {
 }
 
 func GetTheme() *Theme {
+	t := theme.Load()
+	if t == nil {
+		t = DefaultTheme()
+		SetTheme(t)
+		return t
+	}
 	SetStyler()
 
-	return theme
+	return t
 }
 
 const (
@@ -0,0 +1,463 @@
+package theme
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/pelletier/go-toml"
+	"gopkg.in/yaml.v3"
+)
+
+// attributeFlags are the attribute letters understood by Theme.Get.
+const attributeFlags = "lbidrus"
+
+var knownSections = map[string]bool{
+	extendsKey:      true,
+	paletteKey:      true,
+	colorsKey:       true,
+	"TagStyles":     true,
+	"FormatStrings": true,
+	"Ansi":          true,
+	tviewKey:        true,
+}
+
+var tagStyleFields = []string{"FG", "BG", "Attributes", "Inherits", "AsBG", "AsBGAttributes"}
+
+// Diagnostic is a single problem found by validation.
+type Diagnostic struct {
+	File string
+	Line int
+	Path string
+	Msg  string
+}
+
+func (d Diagnostic) Error() string {
+	var sb strings.Builder
+	if d.File != "" {
+		sb.WriteString(d.File)
+		if d.Line > 0 {
+			fmt.Fprintf(&sb, ":%d", d.Line)
+		}
+		sb.WriteString(": ")
+	}
+	if d.Path != "" {
+		sb.WriteString(d.Path)
+		sb.WriteString(": ")
+	}
+	sb.WriteString(d.Msg)
+	return sb.String()
+}
+
+// ValidationError collects every Diagnostic found in a theme.
+type ValidationError struct {
+	Diagnostics []Diagnostic
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Diagnostics))
+	for i, d := range e.Diagnostics {
+		msgs[i] = d.Error()
+	}
+	return fmt.Sprintf("theme: %d problem(s):\n  %s", len(msgs), strings.Join(msgs, "\n  "))
+}
+
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, len(e.Diagnostics))
+	for i, d := range e.Diagnostics {
+		errs[i] = d
+	}
+	return errs
+}
+
+// validColor reports whether s is a color. Names are case-insensitive, as
+// they are in tview tags; parseColor lowercases them for tcell.GetColor.
+func validColor(s string) bool {
+	switch s {
+	case "", "-", "default":
+		return true
+	}
+	if _, ok := tcell.ColorNames[strings.ToLower(s)]; ok {
+		return true
+	}
+	return rxHexCode.MatchString(s) && len(s) == 7
+}
+
+// validColorRef is validColor that also accepts a $name palette reference,
+// which is checked at load time since the palette may live in another layer.
+func validColorRef(s string) bool {
+	return validColor(s) || (isPaletteRef(s) && rxPaletteRef.MatchString(s))
+}
+
+func validAttributes(s string) (bad string) {
+	for _, flag := range s {
+		if !strings.ContainsRune(attributeFlags+attrModifiers, flag) {
+			bad += string(flag)
+		}
+	}
+	return
+}
+
+// ValidateFile checks the theme file at path, every file it extends and its
+// fragments, returning a *ValidationError listing each problem with its file
+// and line.
+func ValidateFile(path string, opts ...LoadOption) error {
+	o, err := newLoadOptions(path, FormatOf(path), opts)
+	if err != nil {
+		return err
+	}
+	layers, err := resolveExtends(themeSource{path: path, format: o.format}, nil)
+	if err != nil {
+		return err
+	}
+	if o.fragmentDir != "" {
+		fragments, err := readFragments(o.fragmentDir)
+		if err != nil {
+			return err
+		}
+		layers = append(layers, fragments...)
+	}
+	v := &validator{}
+	for _, l := range layers {
+		v.file = l.src.String()
+		v.line = lineFinder(l.src.format, l.data)
+		v.validate(l.m)
+	}
+	return v.err()
+}
+
+// Validate checks the styles and colors of an already loaded theme.
+func (t *Theme) Validate() error {
+	v := &validator{}
+	v.validate(t.toMap())
+	return v.err()
+}
+
+type validator struct {
+	file  string
+	line  func(path []string) int
+	diags []Diagnostic
+}
+
+func (v *validator) errorf(path []string, format string, args ...interface{}) {
+	d := Diagnostic{
+		File: v.file,
+		Path: strings.Join(path, "."),
+		Msg:  fmt.Sprintf(format, args...),
+	}
+	if v.line != nil {
+		d.Line = v.line(path)
+	}
+	v.diags = append(v.diags, d)
+}
+
+func (v *validator) err() error {
+	if len(v.diags) == 0 {
+		return nil
+	}
+	return &ValidationError{Diagnostics: v.diags}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (v *validator) validate(m map[string]interface{}) {
+	for _, section := range sortedKeys(m) {
+		path := []string{section}
+		if !knownSections[section] {
+			v.errorf(path, "unknown section")
+			continue
+		}
+		switch section {
+		case "TagStyles":
+			v.validateStyles(path, m[section])
+		case "Ansi":
+			v.validateAnsi(path, m[section])
+		case paletteKey:
+			v.validatePalette(path, m[section])
+		case colorsKey:
+			v.validateColors(path, m[section])
+		case "FormatStrings":
+			v.validateFormats(path, m[section])
+		case tviewKey:
+			v.validateTview(path, m[section])
+		}
+	}
+}
+
+func (v *validator) table(path []string, val interface{}) (map[string]interface{}, bool) {
+	t, ok := val.(map[string]interface{})
+	if !ok {
+		v.errorf(path, "expected a table, got %T", val)
+	}
+	return t, ok
+}
+
+func (v *validator) validateStyles(path []string, val interface{}) {
+	styles, ok := v.table(path, val)
+	if !ok {
+		return
+	}
+	for _, name := range sortedKeys(styles) {
+		v.validateStyle(append(path[:len(path):len(path)], name), styles[name])
+	}
+}
+
+// validateAnsi checks that [Ansi] only remaps the base color names, each to
+// a color or a full TagStyle.
+func (v *validator) validateAnsi(path []string, val interface{}) {
+	styles, ok := v.table(path, val)
+	if !ok {
+		return
+	}
+	for _, name := range sortedKeys(styles) {
+		stylePath := append(path[:len(path):len(path)], name)
+		known := false
+		for _, base := range baseXtermAnsiColorNames {
+			known = known || strings.EqualFold(base, name)
+		}
+		if !known {
+			v.errorf(stylePath, "not one of the 16 base ANSI colors (%s)", strings.Join(baseXtermAnsiColorNames, ", "))
+			continue
+		}
+		if str, ok := styles[name].(string); ok {
+			v.checkColor(stylePath, str)
+			continue
+		}
+		v.validateStyle(stylePath, styles[name])
+	}
+}
+
+func (v *validator) validateStyle(stylePath []string, val interface{}) {
+	style, ok := v.table(stylePath, val)
+	if !ok {
+		return
+	}
+	empty := true
+	for _, field := range sortedKeys(style) {
+		fieldPath := append(stylePath[:len(stylePath):len(stylePath)], field)
+		known := ""
+		for _, f := range tagStyleFields {
+			if strings.EqualFold(f, field) {
+				known = f
+			}
+		}
+		if known == "" {
+			v.errorf(fieldPath, "unknown field")
+			continue
+		}
+		str, ok := style[field].(string)
+		if !ok {
+			v.errorf(fieldPath, "expected a string, got %T", style[field])
+			continue
+		}
+		if str != "" {
+			empty = false
+		}
+		switch known {
+		case "FG", "BG", "AsBG":
+			v.checkColor(fieldPath, str)
+		case "Attributes", "AsBGAttributes":
+			if bad := validAttributes(str); bad != "" {
+				v.errorf(fieldPath, "unknown attribute %q (valid: %s)", bad, attributeFlags)
+			}
+		}
+	}
+	if empty {
+		v.errorf(stylePath, "empty style")
+	}
+}
+
+func (v *validator) validateColors(path []string, val interface{}) {
+	colors, ok := v.table(path, val)
+	if !ok {
+		return
+	}
+	roles := NewTheme()
+	for _, name := range sortedKeys(colors) {
+		rolePath := append(path[:len(path):len(path)], name)
+		if _, ok := roles.colorRole(name); !ok {
+			v.errorf(rolePath, "unknown color role")
+			continue
+		}
+		str, ok := colors[name].(string)
+		if !ok {
+			v.errorf(rolePath, "expected a string, got %T", colors[name])
+			continue
+		}
+		v.checkColor(rolePath, str)
+	}
+}
+
+// checkColor reports str unless it is a color, a palette reference or a
+// well-formed color expression.
+func (v *validator) checkColor(path []string, str string) {
+	if !isColorExpr(str) {
+		if !validColorRef(str) {
+			v.errorf(path, "invalid color %q", str)
+		}
+		return
+	}
+	_, err := evalColor(str, func(string) (string, error) { return "#000000", nil })
+	if err != nil {
+		v.errorf(path, "%v", err)
+	}
+}
+
+func (v *validator) validatePalette(path []string, val interface{}) {
+	colors, ok := v.table(path, val)
+	if !ok {
+		return
+	}
+	for _, name := range sortedKeys(colors) {
+		namePath := append(path[:len(path):len(path)], name)
+		str, ok := colors[name].(string)
+		if !ok {
+			v.errorf(namePath, "expected a string, got %T", colors[name])
+			continue
+		}
+		v.checkColor(namePath, str)
+	}
+}
+
+// validateTview checks field names and literal colors; references to roles
+// and TagStyles are resolved at load time since they may live in another layer.
+func (v *validator) validateTview(path []string, val interface{}) {
+	fields, ok := v.table(path, val)
+	if !ok {
+		return
+	}
+	for _, name := range sortedKeys(fields) {
+		fieldPath := append(path[:len(path):len(path)], name)
+		known := false
+		for _, f := range tviewFields() {
+			known = known || strings.EqualFold(f, name)
+		}
+		if !known {
+			v.errorf(fieldPath, "unknown tview.Theme field")
+			continue
+		}
+		str, ok := fields[name].(string)
+		if !ok {
+			v.errorf(fieldPath, "expected a string, got %T", fields[name])
+			continue
+		}
+		if strings.HasPrefix(str, "#") || isPaletteRef(str) || isColorExpr(str) {
+			v.checkColor(fieldPath, str)
+		}
+	}
+}
+
+func (v *validator) validateFormats(path []string, val interface{}) {
+	formats, ok := v.table(path, val)
+	if !ok {
+		return
+	}
+	for _, name := range sortedKeys(formats) {
+		if _, ok := formats[name].(string); !ok {
+			v.errorf(append(path[:len(path):len(path)], name), "expected a string, got %T", formats[name])
+		}
+	}
+}
+
+// lineFinder returns a lookup from key path to the line it is defined on in
+// data, or nil if the format carries no positions.
+func lineFinder(format string, data []byte) func(path []string) int {
+	switch normalizeFormat(format) {
+	case FormatTOML:
+		tree, err := toml.LoadBytes(data)
+		if err != nil {
+			return nil
+		}
+		return func(path []string) int {
+			return tree.GetPositionPath(path).Line
+		}
+	case FormatYAML:
+		var root yaml.Node
+		if err := yaml.Unmarshal(data, &root); err != nil || len(root.Content) == 0 {
+			return nil
+		}
+		return func(path []string) int {
+			return yamlLine(root.Content[0], path)
+		}
+	case FormatJSON:
+		lines := jsonLines(data)
+		return func(path []string) int {
+			return lines[strings.Join(path, "\x00")]
+		}
+	}
+	return nil
+}
+
+func yamlLine(n *yaml.Node, path []string) int {
+	line := n.Line
+	for _, key := range path {
+		if n.Kind != yaml.MappingNode {
+			return line
+		}
+		found := false
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == key {
+				line = n.Content[i].Line
+				n = n.Content[i+1]
+				found = true
+				break
+			}
+		}
+		if !found {
+			return line
+		}
+	}
+	return line
+}
+
+// jsonLines maps every object key path in data to the line it appears on.
+func jsonLines(data []byte) map[string]int {
+	lines := make(map[string]int)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	var walk func(path []string) error
+	walk = func(path []string) error {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		delim, ok := tok.(json.Delim)
+		if !ok {
+			return nil
+		}
+		switch delim {
+		case '{':
+			for dec.More() {
+				tok, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				key, _ := tok.(string)
+				keyPath := append(path[:len(path):len(path)], key)
+				lines[strings.Join(keyPath, "\x00")] = 1 + bytes.Count(data[:dec.InputOffset()], []byte("\n"))
+				if err := walk(keyPath); err != nil {
+					return err
+				}
+			}
+		case '[':
+			for dec.More() {
+				if err := walk(path); err != nil {
+					return err
+				}
+			}
+		}
+		_, err = dec.Token()
+		return err
+	}
+	walk(nil)
+	return lines
+}
@@ -0,0 +1,289 @@
+package theme
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDelay is how long a ThemeWatcher waits after the last file event
+// before reloading, so the several events of one save cause a single reload.
+var watchDelay = 100 * time.Millisecond
+
+// ThemeWatcher reloads a theme file whenever it or its theme.d fragments
+// change. It watches the containing directories rather than the files, so
+// editors that save by writing a temporary file and renaming it over the
+// original, or by deleting and recreating it, keep being picked up.
+type ThemeWatcher struct {
+	path        string
+	fragmentDir string
+	opts        *loadOptions
+	src         themeSource
+	userOpts    []LoadOption
+	fs          *fsnotify.Watcher
+	done        chan struct{}
+
+	reloadMu  sync.Mutex
+	publishMu sync.Mutex // keeps events in order once reloadMu is released
+	mu        sync.Mutex
+	timer     *time.Timer
+	closed    bool
+}
+
+// Watch loads the theme file at path like LoadTheme, makes it current and
+// reloads it whenever the file or its theme.d directory changes, notifying
+// subscribers after each reload. While another theme is current, as after
+// Themes.SetActive, a reload only updates the themes in Themes loaded from the
+// same file.
+//
+// The file is checked with ValidateFile first, at the start and on every
+// reload, so a file that Watch accepts keeps being accepted. A reload that
+// fails keeps the current theme and sends a ReloadEvent with Err set instead;
+// the next change to the file is tried again.
+func Watch(path string, opts ...LoadOption) (*ThemeWatcher, error) {
+	o, err := newLoadOptions(path, FormatOf(path), opts)
+	if err != nil {
+		return nil, err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	w := &ThemeWatcher{
+		path:     abs,
+		opts:     o,
+		src:      themeSource{path: abs, format: o.format},
+		userOpts: opts,
+		done:     make(chan struct{}),
+	}
+	if o.fragmentDir != "" {
+		if w.fragmentDir, err = filepath.Abs(o.fragmentDir); err != nil {
+			return nil, err
+		}
+	}
+
+	t, err := o.reload(w.path, w.src, opts)
+	if err != nil {
+		return nil, err
+	}
+	SetTheme(t)
+
+	if w.fs, err = fsnotify.NewWatcher(); err != nil {
+		return nil, err
+	}
+	if err := w.fs.Add(filepath.Dir(w.path)); err != nil {
+		w.fs.Close()
+		return nil, err
+	}
+	if w.fragmentDir != "" {
+		if dir := filepath.Dir(w.fragmentDir); dir != filepath.Dir(w.path) {
+			w.addIfDir(dir)
+		}
+		w.addIfDir(w.fragmentDir)
+	}
+	go w.run()
+	return w, nil
+}
+
+// Path is the absolute path of the watched theme file.
+func (w *ThemeWatcher) Path() string {
+	return w.path
+}
+
+// Close stops watching and waits for the watcher goroutine and any reload
+// already in progress to finish; no theme is published afterwards. Events are
+// delivered without holding the watcher's locks, so a subscriber may call
+// Close, and an event already on its way may arrive after Close returns.
+func (w *ThemeWatcher) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.mu.Unlock()
+
+	err := w.fs.Close()
+	<-w.done
+	// A reload whose timer already fired either holds reloadMu or will see
+	// closed once it gets it.
+	w.reloadMu.Lock()
+	w.reloadMu.Unlock()
+	return err
+}
+
+func (w *ThemeWatcher) addIfDir(dir string) {
+	if info, err := os.Stat(dir); err == nil && info.IsDir() {
+		if err := w.fs.Add(dir); err != nil {
+			w.watchError(err)
+		}
+	}
+}
+
+// watchError tells subscribers that changes may go unnoticed. The event is
+// sent from its own goroutine so that run, which Close waits for, never waits
+// on a subscriber.
+func (w *ThemeWatcher) watchError(err error) {
+	ev := ReloadEvent{
+		Path:  w.path,
+		Theme: current(),
+		Err:   newReloadError(w.path, fmt.Errorf("watching: %w", err)),
+	}
+	go w.publish(ev)
+}
+
+func (w *ThemeWatcher) publish(ev ReloadEvent) {
+	w.publishMu.Lock()
+	defer w.publishMu.Unlock()
+	publish(ev)
+}
+
+func (w *ThemeWatcher) run() {
+	defer close(w.done)
+	for {
+		select {
+		case event, ok := <-w.fs.Events:
+			if !ok {
+				return
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			name := filepath.Clean(event.Name)
+			if name == w.fragmentDir && event.Op&fsnotify.Create != 0 {
+				w.addIfDir(name)
+			}
+			if w.relevant(name) {
+				w.schedule()
+			}
+		case err, ok := <-w.fs.Errors:
+			if !ok {
+				return
+			}
+			w.watchError(err)
+		}
+	}
+}
+
+// relevant reports whether a change to name can affect the loaded theme.
+func (w *ThemeWatcher) relevant(name string) bool {
+	if name == w.path {
+		return true
+	}
+	if w.fragmentDir == "" {
+		return false
+	}
+	return name == w.fragmentDir || (filepath.Dir(name) == w.fragmentDir && isThemeFile(name))
+}
+
+func (w *ThemeWatcher) schedule() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+	if w.timer == nil {
+		w.timer = time.AfterFunc(watchDelay, w.reload)
+		return
+	}
+	w.timer.Reset(watchDelay)
+}
+
+// reload loads the file again and then sends the event for it after
+// releasing reloadMu, so subscribers run without blocking Close.
+func (w *ThemeWatcher) reload() {
+	ev, ok := w.reloadEvent()
+	if !ok {
+		return
+	}
+	defer w.publishMu.Unlock()
+	publish(ev)
+}
+
+// reloadEvent does the reload and returns the event to send. When there is
+// one it returns holding publishMu, taken before reloadMu is released so
+// events go out in the order of their reloads.
+func (w *ThemeWatcher) reloadEvent() (ReloadEvent, bool) {
+	w.reloadMu.Lock()
+	defer w.reloadMu.Unlock()
+
+	w.mu.Lock()
+	closed := w.closed
+	w.mu.Unlock()
+	if closed {
+		return ReloadEvent{}, false
+	}
+	// Mid-save the file may briefly not exist; its recreation is another event.
+	if _, err := os.Stat(w.path); os.IsNotExist(err) {
+		return ReloadEvent{}, false
+	}
+
+	var ev ReloadEvent
+	t, err := w.opts.reload(w.path, w.src, w.userOpts)
+	if err != nil {
+		ev = ReloadEvent{Path: w.path, Theme: current(), Err: newReloadError(w.path, err)}
+	} else if changes, ok := w.apply(t); ok {
+		ev = ReloadEvent{Path: w.path, Theme: t, Changes: changes}
+	} else {
+		return ReloadEvent{}, false
+	}
+	w.publishMu.Lock()
+	return ev, true
+}
+
+// apply stores the reloaded theme in Themes under the names it was
+// registered with and makes it current, unless another theme has been made
+// current since, e.g. with Themes.SetActive. It reports whether t is now
+// current.
+func (w *ThemeWatcher) apply(t *Theme) (ChangeSet, bool) {
+	Themes.switchMu.Lock()
+	defer Themes.switchMu.Unlock()
+	Themes.replaceSource(w.path, t)
+	old := current()
+	if old.source != w.path {
+		return ChangeSet{}, false
+	}
+	publishTheme(t)
+	return Diff(old, t), true
+}
+
+var (
+	watchMu  sync.Mutex
+	watching *ThemeWatcher
+)
+
+// WatchTheme is Watch for the package-wide watcher, replacing and closing any
+// watcher started by an earlier WatchTheme call.
+func WatchTheme(path string, opts ...LoadOption) error {
+	w, err := Watch(path, opts...)
+	if err != nil {
+		return err
+	}
+	watchMu.Lock()
+	prev := watching
+	watching = w
+	watchMu.Unlock()
+	if prev != nil {
+		prev.Close()
+	}
+	return nil
+}
+
+// Unwatch stops the watcher started by WatchTheme, if any.
+func Unwatch() error {
+	watchMu.Lock()
+	w := watching
+	watching = nil
+	watchMu.Unlock()
+	if w == nil {
+		return nil
+	}
+	return w.Close()
+}
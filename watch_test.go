@@ -0,0 +1,127 @@
+package theme
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/digitallyserviced/tview"
+)
+
+// TestReloadRace hammers the styler from a stand-in for the draw goroutine
+// while another reloads the theme and changes how it renders. Run it with
+// -race.
+func TestReloadRace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "theme.toml")
+	write := func(i int) {
+		data := fmt.Sprintf("[TagStyles.badgeText]\n  FG = \"#%06x\"\n  Attributes = \"+b\"\n"+
+			"[TagStyles.extra%d]\n  FG = \"red\"\n", i*2654435%0xffffff, i)
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(0)
+	w, err := Watch(path, WithoutEnv())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	defer SetColorDepth(TrueColor)
+	defer SetAnsiRemap(false)
+
+	stale := GetTheme()
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			TagStyler("badgeText", "panelTitle", "u")
+			TagStyler("red", "badgeText.bg", "-")
+			GetTagStyle("consoleMsgErr")
+			GetBackgroundStyle("badgeText")
+			GetTheme().Get("badgeText")
+			if !tview.Styles.TitleColor.Valid() {
+				t.Error("tview.Styles not applied")
+			}
+		}
+	}()
+
+	for i := 1; i <= 20; i++ {
+		write(i)
+		w.reload()
+		SetColorDepth(ColorDepth(i % 4))
+		SetAnsiRemap(i%2 == 0)
+		stale.NewTagStyle(fmt.Sprintf("runtime%d", i), "blue")
+		if i%5 == 0 {
+			WriteDefaultStyles()
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	if _, ok := GetTagStyle("extra20"); !ok {
+		t.Error("last reload is not current")
+	}
+}
+
+func TestMutateStaleSnapshot(t *testing.T) {
+	SetColorDepth(TrueColor)
+	SetTheme(DefaultTheme())
+	snap := GetTheme()
+	snap.NewTagStyle("first", "red")
+	snap.NewTagStyle("second", "blue")
+
+	if _, ok := snap.TagStyles["first"]; ok {
+		t.Error("shared snapshot was modified in place")
+	}
+	for _, name := range []string{"first", "second"} {
+		if _, ok := GetTagStyle(name); !ok {
+			t.Errorf("%s missing from the current theme", name)
+		}
+	}
+
+	fresh := NewTheme()
+	fresh.NewTagStyle("own", "green")
+	if _, ok := fresh.TagStyles["own"]; !ok {
+		t.Error("unshared theme not modified in place")
+	}
+}
+
+func TestCloseFromSubscriber(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "theme.toml")
+	if err := os.WriteFile(path, []byte("[TagStyles.a]\n  FG = \"red\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := Watch(path, WithoutEnv())
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := make(chan struct{})
+	var once sync.Once
+	cancel := Subscribe(func(ev ReloadEvent) {
+		if ev.Path == w.Path() {
+			w.Close()
+			once.Do(func() { close(closed) })
+		}
+	})
+	defer cancel()
+
+	if err := os.WriteFile(path, []byte("[TagStyles.a]\n  FG = \"blue\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	go w.reload()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close called from a subscriber deadlocked")
+	}
+}